@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+type Endereco struct {
+	Rua         string `json:"rua"`
+	Numero      string `json:"numero"`
+	Complemento string `json:"complemento"`
+	Bairro      string `json:"bairro"`
+	Cidade      string `json:"cidade"`
+	UF          string `json:"uf"`
+	CEP         string `json:"cep"`
+}
+
+type AddressRequest struct {
+	Endereco string `json:"endereco"`
+}
+
+type CEPLookup interface {
+	Lookup(cep string) (Endereco, error)
+}
+
+// offline lookup from a json file keyed by cep, ex. {"01001000": {"rua": "Praça da Sé", ...}}
+type LocalCEPLookup struct {
+	entries map[string]Endereco
+}
+
+var (
+	cepPattern       = regexp.MustCompile(`\b(\d{5})-?(\d{3})\b`)
+	cepLabel         = regexp.MustCompile(`(?i)[\s,-]*cep:?\s*$`)
+	addressSeparator = regexp.MustCompile(`\s*[,;]\s*|\s+-\s+`)
+	ufPattern        = regexp.MustCompile(`(?i)(?:^|[\s,/-])([a-z]{2})\s*$`)
+	numberAfterComma = regexp.MustCompile(`(?i)^([^,]+),\s*(?:n[º°o.]?\s*)?(\d+[a-z]?|s/?n)(?:$|[\s,;-])(.*)$`)
+	numberToken      = regexp.MustCompile(`(?i)\s(?:n[º°o.]?\s*)?(\d+[a-z]?|s/?n)(?:$|[\s,;-])`)
+	streetNameNumber = regexp.MustCompile(`(?i)^\s*de\s`)
+	complementPrefix = regexp.MustCompile(`(?i)^(apto?\.?|apartamento|ap\.?|bloco|bl\.?|casa|fundos|sala|lote|quadra|qd\.?|andar|perto|pr[oó]ximo|ao lado|em frente|esquina)\b`)
+	brazilianStates  = []string{"AC", "AL", "AP", "AM", "BA", "CE", "DF", "ES", "GO", "MA", "MT", "MS", "MG", "PA", "PB", "PR", "PE", "PI", "RJ", "RN", "RS", "RO", "RR", "SC", "SP", "SE", "TO"}
+)
+
+// best effort split of a free text address, fields that can't be found stay empty
+func ParseAddress(raw string) Endereco {
+	var address Endereco
+	text := strings.TrimSpace(raw)
+
+	if match := cepPattern.FindStringSubmatch(text); match != nil {
+		address.CEP = match[1] + match[2]
+		text = strings.Replace(text, match[0], "", 1)
+	}
+	text = cepLabel.ReplaceAllString(text, "")
+	text = strings.Trim(strings.TrimSpace(text), ",-")
+
+	if match := ufPattern.FindStringSubmatch(text); match != nil && slices.Contains(brazilianStates, strings.ToUpper(match[1])) {
+		address.UF = strings.ToUpper(match[1])
+		text = strings.Trim(strings.TrimSpace(text[:len(text)-len(match[0])]), ",/-")
+	}
+
+	var rest string
+	address.Rua, address.Numero, rest = splitStreetNumber(text)
+
+	parts := []string{}
+	for _, part := range addressSeparator.Split(rest, -1) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	complements := []string{}
+	places := []string{}
+	for _, part := range parts {
+		if complementPrefix.MatchString(part) {
+			complements = append(complements, part)
+		} else {
+			places = append(places, part)
+		}
+	}
+
+	address.Complemento = strings.Join(complements, ", ")
+	if len(places) > 0 {
+		address.Bairro = places[0]
+	}
+
+	if len(places) > 1 {
+		address.Cidade = strings.Join(places[1:], ", ")
+	}
+
+	return address
+}
+
+// the number right after the street comma, or the first number of the street part that isn't part
+// of its name, so "Rua 7 de Setembro, 45" and "Rua 25 de Março 300" keep the street name
+func splitStreetNumber(text string) (string, string, string) {
+	if match := numberAfterComma.FindStringSubmatch(text); match != nil {
+		return strings.TrimSpace(match[1]), strings.ToUpper(match[2]), strings.TrimLeft(match[3], " ,;-")
+	}
+
+	street, after, _ := strings.Cut(text, ",")
+	for _, match := range numberToken.FindAllStringSubmatchIndex(street, -1) {
+		if streetNameNumber.MatchString(street[match[3]:]) {
+			continue
+		}
+
+		rest := strings.TrimLeft(street[match[3]:], " ,;-")
+		if after != "" {
+			rest = strings.TrimSpace(rest + ", " + after)
+		}
+
+		return strings.Trim(strings.TrimSpace(street[:match[0]]), ",-"), strings.ToUpper(street[match[2]:match[3]]), rest
+	}
+
+	return strings.TrimSpace(street), "", after
+}
+
+func ValidCEP(cep string) bool {
+	digits := nonDigits.ReplaceAllString(cep, "")
+	return len(digits) == 8 && digits != "00000000"
+}
+
+func FormatCEP(cep string) string {
+	digits := nonDigits.ReplaceAllString(cep, "")
+	if len(digits) != 8 {
+		return cep
+	}
+
+	return digits[:5] + "-" + digits[5:]
+}
+
+// fills the empty fields with the values of other
+func (address Endereco) Merge(other Endereco) Endereco {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+
+	fill(&address.Rua, other.Rua)
+	fill(&address.Numero, other.Numero)
+	fill(&address.Complemento, other.Complemento)
+	fill(&address.Bairro, other.Bairro)
+	fill(&address.Cidade, other.Cidade)
+	fill(&address.UF, other.UF)
+	fill(&address.CEP, other.CEP)
+
+	return address
+}
+
+func (address Endereco) MissingFields() []string {
+	missing := []string{}
+	if address.Rua == "" {
+		missing = append(missing, "rua")
+	}
+
+	if address.Numero == "" {
+		missing = append(missing, "número")
+	}
+
+	if address.Bairro == "" {
+		missing = append(missing, "bairro")
+	}
+
+	return missing
+}
+
+func (address Endereco) String() string {
+	line := address.Rua
+	if address.Numero != "" {
+		line = fmt.Sprintf("%s, %s", line, address.Numero)
+	}
+
+	parts := []string{line}
+	for _, part := range []string{address.Complemento, address.Bairro} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	city := address.Cidade
+	if address.UF != "" {
+		city = strings.TrimPrefix(fmt.Sprintf("%s/%s", city, address.UF), "/")
+	}
+
+	if city != "" {
+		parts = append(parts, city)
+	}
+
+	if address.CEP != "" {
+		parts = append(parts, "CEP "+FormatCEP(address.CEP))
+	}
+
+	return strings.Join(parts, " - ")
+}
+
+func LoadLocalCEPLookup(path string) *LocalCEPLookup {
+	lookup := &LocalCEPLookup{entries: map[string]Endereco{}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("CEP file %s not found, CEP lookup disabled\n", path)
+		return lookup
+	}
+	failOnError(err, "Can't open cep file")
+
+	entries := map[string]Endereco{}
+	err = json.Unmarshal(data, &entries)
+	failOnError(err, "Can't parse cep file")
+
+	for cep, address := range entries {
+		lookup.entries[nonDigits.ReplaceAllString(cep, "")] = address
+	}
+
+	return lookup
+}
+
+func (lookup *LocalCEPLookup) Lookup(cep string) (Endereco, error) {
+	address, found := lookup.entries[nonDigits.ReplaceAllString(cep, "")]
+	if !found {
+		return Endereco{}, fmt.Errorf("cep %s not found", FormatCEP(cep))
+	}
+
+	return address, nil
+}
+
+func validateAddressTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "validar_endereco",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Normaliza o endereço de entrega informado pelo usuário em rua, número, complemento, bairro, cidade e CEP. Deve ser chamado assim que o usuário informar o endereço. Mostre o endereço normalizado ao usuário e peça a confirmação."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"endereco",
+				},
+				"properties": map[string]interface{}{
+					"endereco": map[string]string{
+						"type":        "string",
+						"description": "Endereço de entrega como informado pelo usuário",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func confirmAddressTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "confirmar_endereco",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Deve ser chamado quando o usuário confirmar que o endereço normalizado por validar_endereco está correto."),
+			Parameters: openai.FunctionParameters{
+				"type":                 "object",
+				"required":             []string{},
+				"properties":           map[string]interface{}{},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) ValidateAddress(request AddressRequest) string {
+	address := ParseAddress(request.Endereco)
+	chat.PendingAddress = nil
+	chat.ConfirmedAddress = nil
+	chat.Delivery = nil
+
+	if address.CEP != "" && !ValidCEP(address.CEP) {
+		return fmt.Sprintf("CEP %s inválido, peça ao usuário para conferir o CEP", address.CEP)
+	}
+
+	if address.CEP != "" && Vault.CEPLookup != nil {
+		found, err := Vault.CEPLookup.Lookup(address.CEP)
+		if err != nil {
+			fmt.Printf("Warning: %s\n", err)
+		} else {
+			address = address.Merge(found)
+		}
+	}
+
+	if missing := address.MissingFields(); len(missing) > 0 {
+		return fmt.Sprintf("endereço incompleto, peça ao usuário: %s", strings.Join(missing, ", "))
+	}
+
+	chat.PendingAddress = &address
+	return fmt.Sprintf("endereço normalizado: %s. Peça ao usuário para confirmar este endereço e então chame confirmar_endereco", address)
+}
+
+func (chat *WhatsAppChat) ConfirmAddress() string {
+	if chat.PendingAddress == nil {
+		return "nenhum endereço para confirmar, chame validar_endereco primeiro"
+	}
+
+	chat.ConfirmedAddress = chat.PendingAddress
+	chat.PendingAddress = nil
+	return fmt.Sprintf("endereço confirmado: %s", chat.ConfirmedAddress)
+}
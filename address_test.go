@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Endereco
+	}{
+		{
+			in:   "Rua das Flores, 123, Centro",
+			want: Endereco{Rua: "Rua das Flores", Numero: "123", Bairro: "Centro"},
+		},
+		{
+			in:   "Rua das Flores 123 apto 45, Jardim América, São Paulo - SP",
+			want: Endereco{Rua: "Rua das Flores", Numero: "123", Complemento: "apto 45", Bairro: "Jardim América", Cidade: "São Paulo", UF: "SP"},
+		},
+		{
+			in:   "Av. Paulista, nº 1000 - Bela Vista, CEP 01310-100",
+			want: Endereco{Rua: "Av. Paulista", Numero: "1000", Bairro: "Bela Vista", CEP: "01310100"},
+		},
+		{
+			in:   "Rua 7 de Setembro, 45, Centro",
+			want: Endereco{Rua: "Rua 7 de Setembro", Numero: "45", Bairro: "Centro"},
+		},
+		{
+			in:   "Rua 25 de Março 300, Centro",
+			want: Endereco{Rua: "Rua 25 de Março", Numero: "300", Bairro: "Centro"},
+		},
+		{
+			in:   "Avenida 9 de Julho 500 bloco B",
+			want: Endereco{Rua: "Avenida 9 de Julho", Numero: "500", Complemento: "bloco B"},
+		},
+		{
+			in:   "Rua 10, 123, Setor Oeste, Goiânia/GO",
+			want: Endereco{Rua: "Rua 10", Numero: "123", Bairro: "Setor Oeste", Cidade: "Goiânia", UF: "GO"},
+		},
+		{
+			in:   "Rua 15 de Novembro, s/n, Vila Nova",
+			want: Endereco{Rua: "Rua 15 de Novembro", Numero: "S/N", Bairro: "Vila Nova"},
+		},
+		{
+			in:   "Rua 15 de Novembro, Vila Nova",
+			want: Endereco{Rua: "Rua 15 de Novembro", Bairro: "Vila Nova"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			if got := ParseAddress(test.in); got != test.want {
+				t.Errorf("ParseAddress(%q) = %+v, want %+v", test.in, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+type AmendOrderRequest struct {
+	NumeroPedido int       `json:"numero_pedido"`
+	Produtos     []Produto `json:"produtos"`
+	Motivo       string    `json:"motivo"`
+}
+
+type CancelOrderRequest struct {
+	NumeroPedido int    `json:"numero_pedido"`
+	Motivo       string `json:"motivo"`
+}
+
+func amendOrderTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "alterar_pedido",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Altera os produtos de um pedido já finalizado, por exemplo quando o usuário esqueceu de pedir algo. Envie a lista completa de produtos após a alteração. Só é permitido enquanto o pedido não começou a ser preparado."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"numero_pedido",
+					"produtos",
+					"motivo",
+				},
+				"properties": map[string]interface{}{
+					"numero_pedido": map[string]string{
+						"type":        "integer",
+						"description": "Número do pedido a ser alterado",
+					},
+					"produtos": productsSchema("Lista completa de produtos do pedido após a alteração"),
+					"motivo": map[string]string{
+						"type":        "string",
+						"description": "Resumo da alteração pedida pelo usuário",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func cancelOrderTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "cancelar_pedido",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Cancela um pedido já finalizado a pedido do usuário. Confirme com o usuário antes de chamar. Depois de um tempo o cancelamento depende da aprovação da loja."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"numero_pedido",
+					"motivo",
+				},
+				"properties": map[string]interface{}{
+					"numero_pedido": map[string]string{
+						"type":        "integer",
+						"description": "Número do pedido a ser cancelado",
+					},
+					"motivo": map[string]string{
+						"type":        "string",
+						"description": "Motivo do cancelamento informado pelo usuário",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) AmendOrder(request AmendOrderRequest) string {
+	stored := LoadOrder(chat.Number, request.NumeroPedido)
+	if stored == nil {
+		return fmt.Sprintf("pedido #%d não encontrado entre os pedidos deste usuário", request.NumeroPedido)
+	}
+
+	if !slices.Contains(orderEditableStatuses, stored.Status) {
+		return fmt.Sprintf("o pedido #%d não pode mais ser alterado, situação: %s", stored.ID, OrderStatusLabel(stored.Status))
+	}
+
+	method, methodFound := FindPaymentMethod(stored.Order.FormaDePagamento)
+	if methodFound && method.Online && stored.Paid {
+		return fmt.Sprintf("o pedido #%d já foi pago online e não pode ser alterado, ofereça chamar um atendente", stored.ID)
+	}
+
+	if len(request.Produtos) == 0 {
+		return "a alteração precisa de ao menos um produto, para desistir do pedido use cancelar_pedido"
+	}
+
+	order := stored.Order
+	order.Produtos = request.Produtos
+	delivery := stored.Order.DeliveryQuote()
+	order.Recompute(delivery)
+
+	// the change no longer covers the new total, the delivery person settles it
+	if methodFound && order.ComputeChange(method) != nil {
+		order.TrocoPara = 0
+		order.Troco = 0
+	}
+
+	changes := DiffProducts(stored.Order.Produtos, order.Produtos)
+	if len(changes) == 0 {
+		return "nenhuma alteração nos produtos do pedido"
+	}
+
+	// the products of the order go back to the stock before checking the new ones
+	RestoreStock(stored.Order.Produtos)
+	checkout := Checkout{Chat: chat, Order: &order, Delivery: delivery, Method: method, MethodFound: methodFound}
+	if violations := checkout.Validate(amendmentSkippedRules...); len(violations) > 0 {
+		DecrementStock(stored.Order.Produtos)
+		return fmt.Sprintf("pedido não alterado: %s", strings.Join(violations, "; "))
+	}
+	DecrementStock(order.Produtos)
+
+	SaveOrderVersion(*stored, order)
+
+	NotifyStaff(Notification{
+		Event:    EventOrderUpdate,
+		OrderID:  stored.ID,
+		Customer: order.NomeCompleto,
+		Phone:    chat.Number,
+		Message: RenderMessage("pedido_alterado", MessageData{
+			OrderID:       stored.ID,
+			Customer:      order.NomeCompleto,
+			Phone:         chat.Number,
+			Order:         order,
+			Reason:        request.Motivo,
+			Changes:       changes,
+			PreviousTotal: stored.Order.ValorTotal,
+		}),
+	})
+
+	result := fmt.Sprintf("pedido #%d alterado, novo valor total %s (%s)", stored.ID, order.ValorTotal, order.Breakdown())
+
+	// orders awaiting approval get their charge with the new total once approved
+	if methodFound && method.Online && stored.Status == OrderReceived && order.Total() != stored.Order.Total() {
+		CancelPendingCharges(stored.ID)
+		if err := RequestOnlinePayment(stored.ID, chat.Number, order); err != nil {
+			fmt.Printf("Warning: can't create charge for order %d: %s\n", stored.ID, err)
+			NotifyError(fmt.Sprintf("Erro ao gerar o novo link de pagamento do pedido #%d: %s", stored.ID, err), chat.Number)
+			return result + ", mas o novo link de pagamento não pôde ser gerado. Informe que a loja vai entrar em contato para o pagamento"
+		}
+
+		return result + ". Um novo link de pagamento com o valor atualizado foi enviado, o link anterior não deve ser usado"
+	}
+
+	return result
+}
+
+func (chat *WhatsAppChat) CancelOrder(request CancelOrderRequest) string {
+	stored := LoadOrder(chat.Number, request.NumeroPedido)
+	if stored == nil {
+		return fmt.Sprintf("pedido #%d não encontrado entre os pedidos deste usuário", request.NumeroPedido)
+	}
+
+	if stored.Status == OrderCancelRequested {
+		return fmt.Sprintf("o cancelamento do pedido #%d já foi solicitado e aguarda a aprovação da loja", stored.ID)
+	}
+
+	if !slices.Contains(orderEditableStatuses, stored.Status) {
+		return fmt.Sprintf("o pedido #%d não pode mais ser cancelado, situação: %s", stored.ID, OrderStatusLabel(stored.Status))
+	}
+
+	cutoff := time.Duration(Vault.Config.CancellationCutoffMinutes) * time.Minute
+	if cutoff > 0 && time.Since(stored.Created) > cutoff {
+		_, err := SetOrderStatus(stored.ID, OrderCancelRequested)
+		failOnError(err, "Can't request order cancellation")
+
+		NotifyStaff(Notification{
+			Event:    EventCancelRequest,
+			OrderID:  stored.ID,
+			Customer: stored.Order.NomeCompleto,
+			Phone:    chat.Number,
+			Message: RenderMessage("cancelamento_solicitado", MessageData{
+				OrderID:  stored.ID,
+				Customer: stored.Order.NomeCompleto,
+				Phone:    chat.Number,
+				Order:    stored.Order,
+				Reason:   request.Motivo,
+			}),
+		})
+
+		return fmt.Sprintf("cancelamento do pedido #%d solicitado, aguardando aprovação da loja. O usuário será avisado da resposta", stored.ID)
+	}
+
+	_, err := CancelOrder(stored.ID)
+	failOnError(err, "Can't cancel order")
+
+	NotifyStaff(Notification{
+		Event:    EventOrderUpdate,
+		OrderID:  stored.ID,
+		Customer: stored.Order.NomeCompleto,
+		Phone:    chat.Number,
+		Message: RenderMessage("pedido_cancelado_cliente", MessageData{
+			OrderID:  stored.ID,
+			Customer: stored.Order.NomeCompleto,
+			Phone:    chat.Number,
+			Reason:   request.Motivo,
+		}),
+	})
+
+	return fmt.Sprintf("pedido #%d cancelado", stored.ID)
+}
+
+// every cancellation goes through here, whoever asked for it
+func CancelOrder(orderID int) (string, error) {
+	stored := LoadOrderByID(orderID)
+	if stored == nil {
+		return "", fmt.Errorf("pedido #%d não encontrado", orderID)
+	}
+
+	if stored.Status == OrderCancelled || stored.Status == OrderRejected {
+		return "", fmt.Errorf("pedido #%d já está %s", orderID, strings.ToLower(OrderStatusLabel(stored.Status)))
+	}
+
+	phoneNumber, err := SetOrderStatus(orderID, OrderCancelled)
+	if err != nil {
+		return "", err
+	}
+
+	RestoreStock(stored.Order.Produtos)
+	ReleaseDeliverySlot(orderID)
+
+	if stored.Paid {
+		NotifyStaff(Notification{
+			Event:    EventPayment,
+			Message:  RenderMessage("pedido_pago_cancelado", MessageData{OrderID: orderID, Customer: stored.Order.NomeCompleto, Phone: phoneNumber, Order: stored.Order}),
+			OrderID:  orderID,
+			Customer: stored.Order.NomeCompleto,
+			Phone:    phoneNumber,
+		})
+	}
+
+	return phoneNumber, nil
+}
+
+func DiffProducts(before []Produto, after []Produto) []string {
+	key := func(product Produto) string {
+		return product.IdProduto + "|" + normalizeText(product.Detalhes)
+	}
+
+	changes := []string{}
+	for _, product := range after {
+		index := slices.IndexFunc(before, func(old Produto) bool { return key(old) == key(product) })
+		if index < 0 {
+			changes = append(changes, fmt.Sprintf("+ %s", describeProducts([]Produto{product})))
+			continue
+		}
+
+		if before[index].Quantidade != product.Quantidade {
+			changes = append(changes, fmt.Sprintf("~ %s: %d → %d", product.NomeProduto, before[index].Quantidade, product.Quantidade))
+		}
+	}
+
+	for _, product := range before {
+		if !slices.ContainsFunc(after, func(current Produto) bool { return key(current) == key(product) }) {
+			changes = append(changes, fmt.Sprintf("- %s", describeProducts([]Produto{product})))
+		}
+	}
+
+	return changes
+}
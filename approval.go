@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	ApprovalTimeoutApprove  = "approve"
+	ApprovalTimeoutEscalate = "escalate"
+)
+
+type ApprovalConfig struct {
+	Enabled        bool   `json:"enabled"`
+	TimeoutMinutes int    `json:"timeout_minutes"`
+	TimeoutAction  string `json:"timeout_action"`
+}
+
+// asks the owner to approve a new order, with a button when interactive messages are enabled,
+// rejecting needs a reason so it is always typed
+func RequestOrderApproval(orderID int, customerName string) {
+	choice := InteractiveChoice{
+		Titulo:    fmt.Sprintf("Aprovar pedido #%d?", orderID),
+		Descricao: fmt.Sprintf("Pedido de %s aguardando aprovação. Para recusar responda /rejeitar %d <motivo>", customerName, orderID),
+		Opcoes: []InteractiveOption{
+			{ID: fmt.Sprintf("/aprovar %d", orderID), Titulo: "Aprovar"},
+		},
+	}
+
+	if Vault.EnableInteractive {
+		owner := WhatsAppChat{Number: Vault.OwnerNumber}
+		if status := owner.sendButtons(choice); status >= 200 && status < 300 {
+			return
+		}
+	}
+
+	NotifyStaff(Notification{
+		Event:    EventApproval,
+		Message:  RenderMessage("aprovacao_pedido", MessageData{OrderID: orderID, Customer: customerName}),
+		OrderID:  orderID,
+		Customer: customerName,
+	})
+}
+
+func ApproveOrder(orderID int) (string, error) {
+	phoneNumber, err := TransitionOrderStatus(orderID, OrderAwaitingApproval, OrderReceived)
+	if err != nil {
+		return "", err
+	}
+
+	SendMessageToNumber(phoneNumber, RenderMessage("pedido_aprovado", MessageData{OrderID: orderID}))
+
+	stored := LoadOrder(phoneNumber, orderID)
+	if method, found := FindPaymentMethod(stored.Order.FormaDePagamento); found && method.Online {
+		if err := RequestOnlinePayment(orderID, phoneNumber, stored.Order); err != nil {
+			fmt.Printf("Warning: can't create charge for order %d: %s\n", orderID, err)
+			NotifyError(fmt.Sprintf("Erro ao gerar o link de pagamento do pedido #%d: %s", orderID, err), phoneNumber)
+		}
+	}
+
+	return phoneNumber, nil
+}
+
+func RejectOrder(orderID int, reason string) (string, error) {
+	phoneNumber, err := TransitionOrderStatus(orderID, OrderAwaitingApproval, OrderRejected)
+	if err != nil {
+		return "", err
+	}
+
+	if stored := LoadOrder(phoneNumber, orderID); stored != nil {
+		RestoreStock(stored.Order.Produtos)
+	}
+	ReleaseDeliverySlot(orderID)
+
+	SendMessageToNumber(phoneNumber, RenderMessage("pedido_rejeitado", MessageData{OrderID: orderID, Reason: reason}))
+	return phoneNumber, nil
+}
+
+// approves or escalates orders waiting longer than the configured timeout
+func CheckApprovalTimeouts() {
+	config := Vault.Config.Approval
+	if !config.Enabled || config.TimeoutMinutes <= 0 {
+		return
+	}
+
+	rows, err := Vault.PGX.Query(
+		context.Background(),
+		"SELECT id FROM orders WHERE status = $1 AND updated < $2",
+		OrderAwaitingApproval,
+		time.Now().Add(-time.Duration(config.TimeoutMinutes)*time.Minute),
+	)
+	failOnError(err, "Can't load orders awaiting approval")
+
+	orderIDs := []int{}
+	for rows.Next() {
+		var orderID int
+		err = rows.Scan(&orderID)
+		failOnError(err, "Can't scan order awaiting approval")
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+	failOnError(rows.Err(), "Can't read orders awaiting approval")
+
+	for _, orderID := range orderIDs {
+		if config.TimeoutAction == ApprovalTimeoutApprove {
+			if _, err := ApproveOrder(orderID); err != nil {
+				fmt.Printf("Warning: can't auto approve order %d: %s\n", orderID, err)
+				continue
+			}
+
+			NotifyStaff(Notification{
+				Event:   EventApproval,
+				Message: RenderMessage("aprovacao_automatica", MessageData{OrderID: orderID, Minutes: config.TimeoutMinutes}),
+				OrderID: orderID,
+			})
+			continue
+		}
+
+		// touching the order restarts the timeout, so the owner is reminded again later
+		_, err := TransitionOrderStatus(orderID, OrderAwaitingApproval, OrderAwaitingApproval)
+		if err != nil {
+			continue
+		}
+
+		customer := ""
+		if stored := LoadOrderByID(orderID); stored != nil {
+			customer = stored.Order.NomeCompleto
+		}
+
+		NotifyStaff(Notification{
+			Event:    EventApproval,
+			Message:  RenderMessage("aprovacao_lembrete", MessageData{OrderID: orderID, Customer: customer, Minutes: config.TimeoutMinutes}),
+			OrderID:  orderID,
+			Customer: customer,
+		})
+		RequestOrderApproval(orderID, customer)
+	}
+}
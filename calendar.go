@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	calendarPastDays = 30
+	icsTimeLayout    = "20060102T150405Z"
+)
+
+// scheduled deliveries as an icalendar feed, from calendarPastDays ago on
+func calendarFeedHandler(writer http.ResponseWriter, request *http.Request) {
+	if !authorizedCalendar(writer, request) {
+		return
+	}
+
+	from := midnight(time.Now()).AddDate(0, 0, -calendarPastDays)
+	writeCalendar(writer, ScheduledDeliveries(from, time.Time{}), "")
+}
+
+// scheduled deliveries of a single day as a downloadable .ics file
+func calendarDayHandler(writer http.ResponseWriter, request *http.Request) {
+	if !authorizedCalendar(writer, request) {
+		return
+	}
+
+	name := request.PathValue("day")
+	day, err := time.ParseInLocation("2006-01-02", strings.TrimSuffix(name, ".ics"), time.Local)
+	if err != nil || !strings.HasSuffix(name, ".ics") {
+		http.NotFound(writer, request)
+		return
+	}
+
+	filename := fmt.Sprintf("entregas-%s.ics", day.Format("2006-01-02"))
+	writeCalendar(writer, ScheduledDeliveries(day, day.AddDate(0, 0, 1)), filename)
+}
+
+func authorizedCalendar(writer http.ResponseWriter, request *http.Request) bool {
+	token := request.URL.Query().Get("token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(Vault.Config.DeliverySlots.CalendarToken)) != 1 {
+		http.Error(writer, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+func writeCalendar(writer http.ResponseWriter, orders []StoredOrder, filename string) {
+	writer.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if filename != "" {
+		writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+
+	fmt.Fprint(writer, BuildCalendar(orders, time.Now()))
+}
+
+// orders scheduled in [from, until), until zero means no limit. Orders with a chosen slot keep it in
+// delivery_slot, orders placed while closed only have the next opening in the order data
+func ScheduledDeliveries(from time.Time, until time.Time) []StoredOrder {
+	rows, err := Vault.PGX.Query(
+		context.Background(),
+		"SELECT id FROM orders WHERE COALESCE(delivery_slot, (data->>'agendado_para')::timestamptz) >= $1 AND status NOT IN ($2, $3)",
+		from,
+		OrderCancelled,
+		OrderRejected,
+	)
+	failOnError(err, "Can't load scheduled deliveries")
+
+	orderIDs := []int{}
+	for rows.Next() {
+		var orderID int
+		err = rows.Scan(&orderID)
+		failOnError(err, "Can't scan scheduled delivery")
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+	failOnError(rows.Err(), "Can't read scheduled deliveries")
+
+	orders := []StoredOrder{}
+	for _, orderID := range orderIDs {
+		if stored := LoadOrderByID(orderID); stored != nil {
+			orders = append(orders, *stored)
+		}
+	}
+
+	return scheduledBetween(orders, from, until)
+}
+
+// scheduled orders in [from, until) sorted by the delivery time
+func scheduledBetween(orders []StoredOrder, from time.Time, until time.Time) []StoredOrder {
+	scheduled := []StoredOrder{}
+	for _, stored := range orders {
+		at := stored.Order.AgendadoPara
+		if at == nil || at.Before(from) || (!until.IsZero() && !at.Before(until)) {
+			continue
+		}
+
+		scheduled = append(scheduled, stored)
+	}
+
+	slices.SortStableFunc(scheduled, func(a StoredOrder, b StoredOrder) int {
+		return a.Order.AgendadoPara.Compare(*b.Order.AgendadoPara)
+	})
+
+	return scheduled
+}
+
+func BuildCalendar(orders []StoredOrder, now time.Time) string {
+	duration := time.Duration(Vault.Config.DeliverySlots.DurationMinutes) * time.Minute
+	if duration <= 0 {
+		duration = time.Hour
+	}
+
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//talkassist//entregas//PT",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + escapeICS("Entregas agendadas"),
+	}
+
+	for _, stored := range orders {
+		start := *stored.Order.AgendadoPara
+		description := []string{
+			fmt.Sprintf("Pedido #%d - %s", stored.ID, OrderStatusLabel(stored.Status)),
+			fmt.Sprintf("Cliente: %s", stored.Order.NomeCompleto),
+			fmt.Sprintf("Endereço: %s", stored.Order.Endereco),
+			"",
+			formatProductLines(stored.Order.Produtos),
+			"",
+			fmt.Sprintf("Total: %s (%s)", stored.Order.ValorTotal, PaymentLabel(stored.Order.FormaDePagamento)),
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:pedido-%d@talkassist", stored.ID),
+			"DTSTAMP:"+now.UTC().Format(icsTimeLayout),
+			"LAST-MODIFIED:"+stored.Updated.UTC().Format(icsTimeLayout),
+			"DTSTART:"+start.UTC().Format(icsTimeLayout),
+			"DTEND:"+start.Add(duration).UTC().Format(icsTimeLayout),
+			"SUMMARY:"+escapeICS(fmt.Sprintf("Entrega #%d - %s", stored.ID, stored.Order.NomeCompleto)),
+			"LOCATION:"+escapeICS(stored.Order.Endereco),
+			"DESCRIPTION:"+escapeICS(strings.Join(description, "\n")),
+		)
+
+		if Vault.CalendarEmail != "" {
+			lines = append(lines, "ORGANIZER:mailto:"+Vault.CalendarEmail)
+		}
+
+		lines = append(lines, "END:VEVENT")
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	var calendar strings.Builder
+	for _, line := range lines {
+		calendar.WriteString(foldICS(line))
+		calendar.WriteString("\r\n")
+	}
+
+	return calendar.String()
+}
+
+func escapeICS(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// lines longer than 75 octets continue on the next line after a space, without splitting utf-8 characters
+func foldICS(line string) string {
+	var folded strings.Builder
+	length := 0
+	for _, char := range line {
+		size := len(string(char))
+		if length+size > 75 {
+			folded.WriteString("\r\n ")
+			length = 1
+		}
+
+		folded.WriteRune(char)
+		length += size
+	}
+
+	return folded.String()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScheduledBetween(t *testing.T) {
+	day := time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local)
+	at := func(hour int) *time.Time {
+		scheduled := day.Add(time.Duration(hour) * time.Hour)
+		return &scheduled
+	}
+
+	orders := []StoredOrder{
+		{ID: 1, Order: OrdemDeCompra{AgendadoPara: at(15)}},
+		// placed while closed, scheduled for the next opening without a delivery slot
+		{ID: 2, Order: OrdemDeCompra{AgendadoPara: at(9)}},
+		{ID: 3, Order: OrdemDeCompra{AgendadoPara: at(26)}},
+		{ID: 4, Order: OrdemDeCompra{AgendadoPara: at(-2)}},
+		{ID: 5},
+	}
+
+	tests := []struct {
+		name  string
+		until time.Time
+		want  []int
+	}{
+		{"day", day.AddDate(0, 0, 1), []int{2, 1}},
+		{"no limit", time.Time{}, []int{2, 1, 3}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := []int{}
+			for _, stored := range scheduledBetween(orders, day, test.until) {
+				got = append(got, stored.ID)
+			}
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("scheduledBetween() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+type CatalogProduct struct {
+	ID            string   `json:"id"`
+	Nome          string   `json:"nome"`
+	Preco         Money    `json:"preco"`
+	Categoria     string   `json:"categoria"`
+	Variantes     []string `json:"variantes"`
+	Fotos         []string `json:"fotos"`
+	Descontinuado bool     `json:"descontinuado"`
+}
+
+type ProductCatalog struct {
+	Products []CatalogProduct
+	dir      string
+}
+
+func LoadProductCatalog(path string) *ProductCatalog {
+	catalog := &ProductCatalog{
+		Products: []CatalogProduct{},
+		dir:      filepath.Dir(path),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Products file %s not found, product tools will be empty\n", path)
+		return catalog
+	}
+	failOnError(err, "Can't open products file")
+
+	err = json.Unmarshal(data, &catalog.Products)
+	failOnError(err, "Can't parse products file")
+
+	return catalog
+}
+
+// finds a product by id, falling back to a case insensitive name match
+func (catalog *ProductCatalog) Find(idOrName string) (*CatalogProduct, bool) {
+	idOrName = strings.TrimSpace(idOrName)
+
+	for i := range catalog.Products {
+		if catalog.Products[i].ID == idOrName {
+			return &catalog.Products[i], true
+		}
+	}
+
+	for i := range catalog.Products {
+		if strings.EqualFold(catalog.Products[i].Nome, idOrName) {
+			return &catalog.Products[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func (catalog *ProductCatalog) PhotoPath(photo string) string {
+	if filepath.IsAbs(photo) {
+		return photo
+	}
+
+	return filepath.Join(catalog.dir, photo)
+}
+
+type CatalogRequest struct {
+	Categoria string `json:"categoria"`
+}
+
+func listCatalogTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "consultar_catalogo",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Lista os produtos disponíveis com preço e variações em estoque. Deve ser chamado quando o usuário perguntar o que a loja vende ou quais sabores existem, ofereça apenas os produtos retornados."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"categoria",
+				},
+				"properties": map[string]interface{}{
+					"categoria": map[string]string{
+						"type":        "string",
+						"description": "Categoria dos produtos, vazio para todas",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// discontinued and sold out products and variants are left out
+func (chat *WhatsAppChat) ListCatalog(request CatalogRequest) string {
+	levels := LoadStock()
+	lines := []string{}
+	for _, product := range Vault.Products.Products {
+		if product.Descontinuado || (request.Categoria != "" && normalizeText(product.Categoria) != normalizeText(request.Categoria)) {
+			continue
+		}
+
+		if level := findStock(levels, product.ID, ""); level != nil && level.Quantity <= 0 {
+			continue
+		}
+
+		line := fmt.Sprintf("%s - %s - %s", product.ID, product.Nome, product.Preco)
+		if len(product.Variantes) > 0 {
+			variants := availableVariants(levels, product)
+			if len(variants) == 0 {
+				continue
+			}
+			line = fmt.Sprintf("%s - variações: %s", line, strings.Join(variants, ", "))
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return "nenhum produto disponível nesta categoria"
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -1,13 +1,9 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"time"
 
 	"github.com/openai/openai-go"
@@ -21,6 +17,9 @@ type WhatsAppChatMessage struct {
 	ToolCallMessage openai.ChatCompletionMessage
 	FileBase64      string
 	FileMimetype    string
+	MessageID       string
+	QuotedID        string
+	QuotedText      string
 }
 
 type WhatsAppChat struct {
@@ -31,137 +30,68 @@ type WhatsAppChat struct {
 	ToolCall             openai.ChatCompletionMessageToolCall
 	ToolCallMessageParam openai.ChatCompletionMessageParamUnion
 	ToolCallMessage      openai.ChatCompletionMessage
-	AllowSendReceipt     bool
+	AwaitingReceipt      bool
 	Fullname             string
 	Order                OrdemDeCompra
 	Receipt              EvolutionMedia
+	SharedLocation       *EvolutionLocation
+	PendingOptions       []InteractiveOption
+	PhotosSentInTurn     int
+	SentDocuments        []SentDocument
+	Delivery             *DeliveryQuote
+	PendingAddress       *Endereco
+	ConfirmedAddress     *Endereco
+	Customer             *Customer
+	ProfileLoaded        bool
+	Cart                 []Produto
+	Coupon               string
+	DeliverySlot         *time.Time
+	PlacedOrderID        int
 }
 
-func (chat *WhatsAppChat) SendToOpenAI(message string, messageRole string, file *EvolutionMedia) {
+func (chat *WhatsAppChat) SendToOpenAI(chatMessage WhatsAppChatMessage) {
 	client := openai.NewClient(
 		option.WithAPIKey(Vault.OpenAIApiKey),
 	)
 	endConversation := false
 
-	chatMessage := WhatsAppChatMessage{
-		Role: messageRole,
-		Text: message,
+	// let the user know we are working on it
+	if chatMessage.Role == "user" {
+		chat.MarkAsRead(chatMessage.MessageID)
 	}
-
-	if file != nil {
-		chatMessage.FileBase64 = file.Base64
-		chatMessage.FileMimetype = file.MimeType
-		chat.Receipt = *file
+	stopTyping := chat.StartTyping()
+	defer stopTyping()
+
+	// returning customers get their profile once per conversation, whatever message starts it
+	if !chat.ProfileLoaded {
+		chat.ProfileLoaded = true
+		chat.Customer = LoadCustomer(chat.Number)
+		if chat.Customer != nil {
+			chat.Messages = append(chat.Messages, WhatsAppChatMessage{
+				Role: "developer",
+				Text: chat.Customer.Profile(),
+			})
+		} else if chat.Fullname != "" {
+			// customers from before the profiles only have the name of the suspended chat
+			chat.Messages = append(chat.Messages, WhatsAppChatMessage{
+				Role: "developer",
+				Text: fmt.Sprintf("Este usuário já interagiu conosco antes e o nome completo dele é %s", chat.Fullname),
+			})
+		}
 	}
 
 	chat.Messages = append(chat.Messages, chatMessage)
 	chat.LastInteractionTime = time.Now()
+	chat.PhotosSentInTurn = 0
 
 	// TODO Wait for X seconds before send (buffer messages)
 
-	finishCheckout := openai.ChatCompletionToolParam{
-		Function: openai.FunctionDefinitionParam{
-			Name:        "finalizar_checkout",
-			Strict:      openai.Bool(true),
-			Description: openai.String("Deve ser chamado após finalizar a escolha dos produtos e uma forma de pagamento. Ou seja, assim que você retonar a mensagem \"Pedido confirmado\". Não precisa validar o comprovante pix para chamar esta função"),
-			Parameters: openai.FunctionParameters{
-				"type": "object",
-				"required": []string{
-					"produtos",
-					"valor_total",
-					"nome_completo",
-					"endereco",
-					"forma_de_pagamento",
-				},
-				"properties": map[string]interface{}{
-					"produtos": map[string]interface{}{
-						"type":        "array",
-						"description": "Lista de produtos no carrinho",
-						"items": map[string]interface{}{
-							"type": "object",
-							"properties": map[string]interface{}{
-								"id_produto": map[string]string{
-									"type":        "string",
-									"description": "Identificador único do produto",
-								},
-								"nome_produto": map[string]string{
-									"type":        "string",
-									"description": "Nome do produto",
-								},
-								"quantidade": map[string]string{
-									"type":        "number",
-									"description": "Quantidade do produto",
-								},
-								"valor": map[string]string{
-									"type":        "string",
-									"description": "Preço unitário do produto",
-								},
-								"detalhes": map[string]string{
-									"type":        "string",
-									"description": "Sabor e qualquer outro detalhe acrescentado durante a conversa",
-								},
-							},
-							"additionalProperties": false,
-							"required": []string{
-								"id_produto",
-								"nome_produto",
-								"quantidade",
-								"valor",
-								"detalhes",
-							},
-						},
-					},
-					"valor_total": map[string]string{
-						"type":        "string",
-						"description": "Valor total da compra, somando todos os produtos",
-					},
-					"nome_completo": map[string]string{
-						"type":        "string",
-						"description": "Nome completo do usuário",
-					},
-					"endereco": map[string]string{
-						"type":        "string",
-						"description": "Endereço de entrega dos produtos",
-					},
-					"forma_de_pagamento": map[string]interface{}{
-						"type":        "string",
-						"description": "A forma de pagamento escolhida pelo usuário",
-						"enum": []string{
-							"cartao_de_credito",
-							"cartao_de_debito",
-							"dinheiro",
-							"pix",
-						},
-					},
-				},
-				"additionalProperties": false,
-			},
-		},
-	}
-
-	sendCatalog := openai.ChatCompletionToolParam{
-		Function: openai.FunctionDefinitionParam{
-			Name:        "enviar_catalogo",
-			Strict:      openai.Bool(true),
-			Description: openai.String("Enviar o catálogo para o usuário quando pedido. Deverá ser chamado quando o usuário pedir o catálogo."),
-			Parameters: openai.FunctionParameters{
-				"type":                 "object",
-				"required":             []string{},
-				"properties":           map[string]interface{}{},
-				"additionalProperties": false,
-			},
-		},
-	}
-
 	messages := []openai.ChatCompletionMessageParamUnion{
-		openai.SystemMessage(Vault.SystemMessage),
+		openai.SystemMessage(SystemPrompt(time.Now())),
 	}
 
-	if chat.Fullname != "" && len(chat.Messages) == 0 {
-		chat.Messages = append(chat.Messages, WhatsAppChatMessage{
-			Role: "developer",
-			Text: fmt.Sprintf("Este usuário já interagiu conosco antes e o nome completo dele é %s", chat.Fullname),
-		})
+	if note := OutOfStockNote(); note != "" {
+		messages = append(messages, openai.DeveloperMessage(note))
 	}
 
 	for _, msg := range chat.Messages {
@@ -169,10 +99,15 @@ func (chat *WhatsAppChat) SendToOpenAI(message string, messageRole string, file
 		case "user":
 			var message openai.ChatCompletionMessageParamUnion
 
+			text := msg.Text
+			if msg.QuotedText != "" {
+				text = fmt.Sprintf("(respondendo à mensagem: \"%s\")\n%s", msg.QuotedText, msg.Text)
+			}
+
 			if msg.FileBase64 != "" {
 				if msg.FileMimetype == "image/jpeg" || msg.FileMimetype == "image/jpg" {
 					message = openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
-						openai.TextContentPart(msg.Text),
+						openai.TextContentPart(text),
 						openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
 							URL: fmt.Sprintf("data:%s;base64,%s", msg.FileMimetype, msg.FileBase64),
 						}),
@@ -190,7 +125,7 @@ func (chat *WhatsAppChat) SendToOpenAI(message string, messageRole string, file
 					// })
 				}
 			} else {
-				message = openai.UserMessage(msg.Text)
+				message = openai.UserMessage(text)
 			}
 
 			messages = append(messages, message)
@@ -206,99 +141,38 @@ func (chat *WhatsAppChat) SendToOpenAI(message string, messageRole string, file
 	}
 
 	params := openai.ChatCompletionNewParams{
-		Messages: messages,
-		Tools: []openai.ChatCompletionToolParam{
-			finishCheckout,
-			sendCatalog,
-		},
-		Temperature: openai.Float(1.0),
-		Model:       "gpt-4.1",
-		Seed:        openai.Int(0),
+		Messages:          messages,
+		Tools:             chat.Tools(),
+		ParallelToolCalls: openai.Bool(false),
+		Temperature:       openai.Float(1.0),
+		Model:             "gpt-4.1",
+		Seed:              openai.Int(0),
 	}
 
 	res, err := client.Chat.Completions.New(context.Background(), params)
 	failOnError(err, "Can't send messages to OpenAI")
 	chat.OpenAIStack = *res
 
-	// check enviar catalogo tool call
-	if chat.HasToolCallInLastMessage("enviar_catalogo", true) {
-		chat.SendDocToWhatsapp(Vault.CatalogAttachment, "application/pdf", "Catálogo.pdf")
-		res, err = chat.SendToolCallResponse("catálogo enviado", &params, &client)
-		failOnError(err, "Can't send messages to OpenAI")
-		chat.AllowSendReceipt = true
-	}
-
-	// check finalizar_checkout tool call
-	if chat.HasToolCallInLastMessage("finalizar_checkout", true) {
-		err = GetToolArgs(chat.ToolCall, &chat.Order)
-		failOnError(err, "Can't parse tool args")
+	// after the conversation is over the model only answers the user
+	for round := 0; round < maxToolRounds && !endConversation && chat.NextToolCall(); round++ {
+		toolResult, finished := chat.HandleToolCall()
+		endConversation = endConversation || finished
 
-		res, err = chat.SendToolCallResponse("pedido recebido, aguardando comprovante", &params, &client)
+		res, err = chat.SendToolCallResponse(toolResult, &params, &client)
 		failOnError(err, "Can't send messages to OpenAI")
-
-		chat.Fullname = chat.Order.NomeCompleto
-		var orderStr string
-		var paymentMethod string
-
-		for _, product := range chat.Order.Produtos {
-			productDetail := ""
-			if product.Detalhes != "" {
-				productDetail = fmt.Sprintf(" (%s)", product.Detalhes)
-			}
-			orderStr = fmt.Sprintf("%s\n%d %s%s, %s", orderStr, product.Quantidade, product.NomeProduto, productDetail, product.Valor)
-		}
-
-		if chat.Order.FormaDePagamento == "pix" {
-			mediaType := "image"
-			if chat.Receipt.MediaType == "documentMessage" {
-				mediaType = "document"
-			}
-			SendMediaToNumber(
-				Vault.OwnerNumber,
-				[]byte(chat.Receipt.Base64),
-				mediaType,
-				chat.Receipt.MimeType,
-				fmt.Sprintf("Comprovante de %s", chat.Fullname),
-				false,
-			)
-		}
-
-		switch chat.Order.FormaDePagamento {
-		case "pix":
-			paymentMethod = "Pix"
-		case "cartao_de_credito":
-			paymentMethod = "Cartão de crédito"
-		case "cartao_de_debito":
-			paymentMethod = "Cartão de débito"
-		case "dinheiro":
-			paymentMethod = "Dinheiro"
-		}
-
-		SendMessageToNumber(
-			Vault.OwnerNumber,
-			fmt.Sprintf(
-				"Pedido de %s no valor total de %s\n\n%s\n\nEndereço de entrega: %s\nForma de pagamento: %s\nhttps://wa.me/%s",
-				chat.Fullname,
-				chat.Order.ValorTotal,
-				orderStr,
-				chat.Order.Endereco,
-				paymentMethod,
-				chat.Number,
-			),
-		)
-
-		endConversation = true
+		chat.OpenAIStack = *res
 	}
 
-	chat.OpenAIStack = *res
 	lastMessage := chat.OpenAIStack.Choices[len(chat.OpenAIStack.Choices)-1]
+	var messageID string
 	if lastMessage.Message.Role == "assistant" {
-		chat.SendMessageToWhatsApp(lastMessage.Message.Content)
+		messageID = chat.SendReplyToWhatsApp(lastMessage.Message.Content, stopTyping)
 	}
 
 	chat.Messages = append(chat.Messages, WhatsAppChatMessage{
-		Role: string(lastMessage.Message.Role),
-		Text: string(lastMessage.Message.Content),
+		Role:      string(lastMessage.Message.Role),
+		Text:      string(lastMessage.Message.Content),
+		MessageID: messageID,
 	})
 
 	if endConversation {
@@ -327,56 +201,6 @@ func (chat *WhatsAppChat) SendToolCallResponse(message string, params *openai.Ch
 	return client.Chat.Completions.New(context.Background(), *params)
 }
 
-func (chat WhatsAppChat) SendMessageToWhatsApp(message string) {
-	body, _ := json.Marshal(map[string]string{
-		"number": chat.Number,
-		"text":   message,
-	})
-
-	req, err := http.NewRequest(
-		http.MethodPost,
-		fmt.Sprintf("%s/message/sendText/%s", Vault.EvolutionURL, Vault.InstanceID),
-		bytes.NewBuffer(body),
-	)
-	failOnError(err, "Can't create request to evolution api")
-
-	req.Header.Add("apikey", Vault.EvolutionToken)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(req)
-	failOnError(err, "Can't send message to evolution api")
-
-	_, err = io.ReadAll(res.Body)
-	failOnError(err, "Can't parse response")
-	fmt.Printf("Message sent to whatsapp (%s): %s\n", chat.Number, message)
-}
-
-func (chat WhatsAppChat) SendDocToWhatsapp(file []byte, mimeType string, fileName string) {
-	doc := base64.StdEncoding.EncodeToString(file)
-	body, _ := json.Marshal(map[string]string{
-		"number":    chat.Number,
-		"mimetype":  mimeType,
-		"mediatype": "document",
-		"fileName":  fileName,
-		"media":     doc,
-	})
-
-	req, err := http.NewRequest(
-		http.MethodPost,
-		fmt.Sprintf("%s/message/sendMedia/%s", Vault.EvolutionURL, Vault.InstanceID),
-		bytes.NewBuffer(body),
-	)
-	failOnError(err, "Can't create request to evolution api")
-
-	req.Header.Add("apikey", Vault.EvolutionToken)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(req)
-	failOnError(err, "Can't parse response")
-
-	resBody, _ := io.ReadAll(res.Body)
-	fmt.Println(string(resBody))
-	fmt.Println("Doc sent to whatsapp")
-}
-
 func (chat WhatsAppChat) Suspend() {
 	marshed, err := json.Marshal(chat)
 	failOnError(err, "Failed to marshal chat")
@@ -404,7 +228,38 @@ func (chat WhatsAppChat) SaveToLog() {
 
 func (chat *WhatsAppChat) Clear() {
 	chat.Messages = []WhatsAppChatMessage{}
-	chat.AllowSendReceipt = false
+	chat.AwaitingReceipt = false
+	chat.Receipt = EvolutionMedia{}
+	chat.SharedLocation = nil
+	chat.PendingOptions = nil
+	chat.Delivery = nil
+	chat.PendingAddress = nil
+	chat.ConfirmedAddress = nil
+	chat.Cart = nil
+	chat.Coupon = ""
+	chat.DeliverySlot = nil
+	chat.ProfileLoaded = false
+	chat.PlacedOrderID = 0
+	chat.SentDocuments = nil
+}
+
+func (chat WhatsAppChat) FindMessageByID(messageID string) *WhatsAppChatMessage {
+	if messageID == "" {
+		return nil
+	}
+
+	for i := len(chat.Messages) - 1; i >= 0; i-- {
+		if chat.Messages[i].MessageID == messageID {
+			return &chat.Messages[i]
+		}
+	}
+
+	return nil
+}
+
+// set when the chosen payment method requires a receipt, images and files are taken as the receipt
+func (chat WhatsAppChat) AwaitingPayment() bool {
+	return chat.AwaitingReceipt
 }
 
 func (chat *WhatsAppChat) HasToolCallInLastMessage(functionName string, write bool) bool {
@@ -428,91 +283,6 @@ func (chat *WhatsAppChat) HasToolCallInLastMessage(functionName string, write bo
 	return false
 }
 
-func SendMediaToNumber(number string, file []byte, mediatype string, mimeType string, fileName string, encodeBase64 bool) {
-	doc := string(file)
-	if encodeBase64 {
-		doc = base64.StdEncoding.EncodeToString(file)
-	}
-
-	body, _ := json.Marshal(map[string]string{
-		"number":    number,
-		"mimetype":  mimeType,
-		"mediatype": mediatype,
-		"fileName":  fileName,
-		"media":     doc,
-	})
-
-	req, err := http.NewRequest(
-		http.MethodPost,
-		fmt.Sprintf("%s/message/sendMedia/%s", Vault.EvolutionURL, Vault.InstanceID),
-		bytes.NewBuffer(body),
-	)
-	failOnError(err, "Can't create request to evolution api")
-
-	req.Header.Add("apikey", Vault.EvolutionToken)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(req)
-	failOnError(err, "Can't parse response")
-
-	resBody, _ := io.ReadAll(res.Body)
-	fmt.Println(string(resBody))
-	fmt.Println("Doc sent to whatsapp")
-}
-
-func SendMessageToNumber(number string, message string) {
-	body, _ := json.Marshal(map[string]string{
-		"number": number,
-		"text":   message,
-	})
-
-	req, err := http.NewRequest(
-		http.MethodPost,
-		fmt.Sprintf("%s/message/sendText/%s", Vault.EvolutionURL, Vault.InstanceID),
-		bytes.NewBuffer(body),
-	)
-	failOnError(err, "Can't create request to evolution api")
-
-	req.Header.Add("apikey", Vault.EvolutionToken)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(req)
-	failOnError(err, "Can't send message to evolution api")
-
-	_, err = io.ReadAll(res.Body)
-	failOnError(err, "Can't parse response")
-	fmt.Printf("Message sent to whatsapp (%s): %s\n", number, message)
-}
-
-func GetMediaBase64(key string) EvolutionMedia {
-	body, _ := json.Marshal(map[string]any{
-		"message": map[string]any{
-			"key": map[string]string{
-				"id": key,
-			},
-		},
-		"convertToMp4": false,
-	})
-
-	req, err := http.NewRequest(
-		http.MethodPost,
-		fmt.Sprintf("%s/chat/getBase64FromMediaMessage/%s", Vault.EvolutionURL, Vault.InstanceID),
-		bytes.NewBuffer(body),
-	)
-	failOnError(err, "Can't create request to evolution api")
-
-	req.Header.Add("apikey", Vault.EvolutionToken)
-	req.Header.Add("Content-Type", "application/json")
-	res, err := http.DefaultClient.Do(req)
-	failOnError(err, "Can't send message to evolution api")
-
-	resp, err := io.ReadAll(res.Body)
-	failOnError(err, "Can't parse response")
-
-	var respData EvolutionMedia
-	json.Unmarshal(resp, &respData)
-
-	return respData
-}
-
 func GetToolArgs[T any](toolCall openai.ChatCompletionMessageToolCall, to *T) error {
 	var args T
 	err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args)
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+type OrderRulesConfig struct {
+	MinSubtotal        Money             `json:"min_subtotal"`
+	MaxQuantityPerItem int               `json:"max_quantity_per_item"`
+	ZoneRestrictions   []ZoneRestriction `json:"zone_restrictions"`
+	Disabled           []string          `json:"disabled"`
+}
+
+// products or categories delivered only to the listed zones
+type ZoneRestriction struct {
+	Products   []string `json:"products"`
+	Categories []string `json:"categories"`
+	Zones      []string `json:"zones"`
+}
+
+// order being finished, rules read the chat and may adjust the order, the delivery is quoted from the confirmed address
+type Checkout struct {
+	Chat          *WhatsAppChat
+	Order         *OrdemDeCompra
+	Delivery      *DeliveryQuote
+	DeliveryError error
+	Method        PaymentMethod
+	MethodFound   bool
+}
+
+// returns the violations in a way the model can explain to the user
+type OrderRule struct {
+	Name  string
+	Check func(checkout *Checkout) []string
+}
+
+// run in order, every enabled rule runs so the model gets all violations at once
+var orderRules = []OrderRule{
+	{"horario", checkBusinessHoursRule},
+	{"endereco", checkAddressRule},
+	{"frete", checkDeliveryRule},
+	{"agendamento", checkDeliverySlotRule},
+	{"produtos", checkProductsRule},
+	{"estoque", checkStockRule},
+	{"quantidade_maxima", checkMaxQuantityRule},
+	{"valor_minimo", checkMinSubtotalRule},
+	{"zona_produtos", checkZoneRestrictionsRule},
+	{"pagamento", checkPaymentRule},
+	{"cupom", checkCouponRule},
+	{"troco", checkChangeRule},
+	{"comprovante", checkReceiptRule},
+}
+
+// amendments keep the address, slot, coupon and receipt of the order, and the change is settled on delivery
+var amendmentSkippedRules = []string{"horario", "endereco", "agendamento", "cupom", "troco", "comprovante"}
+
+func (config OrderRulesConfig) Validate() error {
+	for _, name := range config.Disabled {
+		if !slices.ContainsFunc(orderRules, func(rule OrderRule) bool { return rule.Name == name }) {
+			return fmt.Errorf("unknown order rule %s", name)
+		}
+	}
+
+	return nil
+}
+
+func (checkout *Checkout) Validate(skipped ...string) []string {
+	violations := []string{}
+	for _, rule := range orderRules {
+		if slices.Contains(Vault.Config.OrderRules.Disabled, rule.Name) || slices.Contains(skipped, rule.Name) {
+			continue
+		}
+
+		violations = append(violations, rule.Check(checkout)...)
+	}
+
+	return violations
+}
+
+func checkAddressRule(checkout *Checkout) []string {
+	if checkout.Chat.ConfirmedAddress == nil {
+		return []string{"chame validar_endereco e confirme o endereço normalizado com o usuário"}
+	}
+
+	return nil
+}
+
+func checkDeliveryRule(checkout *Checkout) []string {
+	if !Vault.Config.Delivery.Enabled() || checkout.Delivery != nil {
+		return nil
+	}
+
+	if checkout.DeliveryError != nil {
+		return []string{fmt.Sprintf("não é possível entregar no endereço confirmado: %s", checkout.DeliveryError)}
+	}
+
+	if checkout.Chat.ConfirmedAddress == nil {
+		return []string{"chame calcular_frete com o endereço de entrega"}
+	}
+
+	return nil
+}
+
+func checkProductsRule(checkout *Checkout) []string {
+	if len(checkout.Order.Produtos) == 0 {
+		return []string{"o pedido não tem produtos"}
+	}
+
+	violations := []string{}
+	for _, product := range checkout.Order.Produtos {
+		if product.Quantidade <= 0 {
+			violations = append(violations, fmt.Sprintf("quantidade inválida para %s", product.NomeProduto))
+		}
+
+		if len(Vault.Products.Products) == 0 {
+			continue
+		}
+
+		catalogProduct, found := Vault.Products.Find(product.IdProduto)
+		if !found {
+			violations = append(violations, fmt.Sprintf("%s não está no catálogo", product.NomeProduto))
+		} else if catalogProduct.Descontinuado {
+			violations = append(violations, fmt.Sprintf("%s não está mais disponível", catalogProduct.Nome))
+		}
+	}
+
+	return violations
+}
+
+func checkStockRule(checkout *Checkout) []string {
+	return CheckStock(checkout.Order.Produtos)
+}
+
+func checkMaxQuantityRule(checkout *Checkout) []string {
+	limit := Vault.Config.OrderRules.MaxQuantityPerItem
+	if limit <= 0 {
+		return nil
+	}
+
+	violations := []string{}
+	for _, product := range checkout.Order.Produtos {
+		if product.Quantidade > limit {
+			violations = append(violations, fmt.Sprintf("a quantidade máxima por item é %d, %s tem %d", limit, product.NomeProduto, product.Quantidade))
+		}
+	}
+
+	return violations
+}
+
+func checkMinSubtotalRule(checkout *Checkout) []string {
+	minimum := Vault.Config.OrderRules.MinSubtotal
+	if minimum > 0 && checkout.Order.Subtotal < minimum {
+		return []string{fmt.Sprintf("o pedido mínimo é de %s em produtos, o pedido tem %s", minimum, checkout.Order.Subtotal)}
+	}
+
+	return nil
+}
+
+func checkZoneRestrictionsRule(checkout *Checkout) []string {
+	if checkout.Delivery == nil {
+		return nil
+	}
+
+	violations := []string{}
+	for _, product := range checkout.Order.Produtos {
+		for _, restriction := range Vault.Config.OrderRules.ZoneRestrictions {
+			if restriction.Applies(product) && !slices.ContainsFunc(restriction.Zones, func(zone string) bool {
+				return normalizeText(zone) == normalizeText(checkout.Delivery.Zone)
+			}) {
+				violations = append(violations, fmt.Sprintf("%s não é entregue na região %s, apenas em %s", product.NomeProduto, checkout.Delivery.Zone, strings.Join(restriction.Zones, ", ")))
+				break
+			}
+		}
+	}
+
+	return violations
+}
+
+func (restriction ZoneRestriction) Applies(product Produto) bool {
+	if slices.Contains(restriction.Products, product.IdProduto) {
+		return true
+	}
+
+	catalogProduct, found := Vault.Products.Find(product.IdProduto)
+	return found && slices.ContainsFunc(restriction.Categories, func(category string) bool {
+		return normalizeText(category) == normalizeText(catalogProduct.Categoria)
+	})
+}
+
+func checkPaymentRule(checkout *Checkout) []string {
+	if !checkout.MethodFound {
+		return []string{fmt.Sprintf("forma de pagamento %s não aceita, opções: %s", checkout.Order.FormaDePagamento, describePaymentMethods())}
+	}
+
+	if err := checkout.Method.Available(checkout.Order.Subtotal, checkout.Order.ZonaEntrega); err != nil {
+		return []string{fmt.Sprintf("%s, peça ao usuário outra forma de pagamento", err)}
+	}
+
+	return nil
+}
+
+func checkCouponRule(checkout *Checkout) []string {
+	if checkout.Chat.Coupon == "" {
+		return nil
+	}
+
+	if _, err := ValidateCoupon(checkout.Chat.Coupon, checkout.Chat.Number, time.Now()); err != nil {
+		checkout.Chat.Coupon = ""
+		return []string{fmt.Sprintf("%s, informe o usuário que o pedido segue sem o cupom", err)}
+	}
+
+	return nil
+}
+
+func checkChangeRule(checkout *Checkout) []string {
+	if !checkout.MethodFound {
+		return nil
+	}
+
+	if err := checkout.Order.ComputeChange(checkout.Method); err != nil {
+		return []string{err.Error()}
+	}
+
+	return nil
+}
+
+func checkReceiptRule(checkout *Checkout) []string {
+	if checkout.MethodFound && checkout.Method.ReceiptRequired && checkout.Chat.Receipt.Base64 == "" {
+		checkout.Chat.AwaitingReceipt = true
+		return []string{fmt.Sprintf("o pagamento com %s exige comprovante, peça ao usuário para enviar o comprovante", checkout.Method.Label)}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+type StoreConfig struct {
+	ProductsFile     string `json:"products_file"`
+	MaxPhotosPerTurn int    `json:"max_photos_per_turn"`
+	DocumentsDir     string `json:"documents_dir"`
+	CatalogFile      string `json:"catalog_file"`
+	CEPFile          string `json:"cep_file"`
+	MessagesDir      string `json:"messages_dir"`
+
+	CancellationCutoffMinutes int `json:"cancellation_cutoff_minutes"`
+
+	Approval ApprovalConfig `json:"approval"`
+
+	PaymentMethods []PaymentMethod      `json:"payment_methods"`
+	PaymentGateway PaymentGatewayConfig `json:"payment_gateway"`
+
+	Promotions []Promotion `json:"promotions"`
+
+	OrderRules OrderRulesConfig `json:"order_rules"`
+
+	BusinessHours BusinessHoursConfig `json:"business_hours"`
+
+	DeliverySlots DeliverySlotsConfig `json:"delivery_slots"`
+
+	Notifications NotificationsConfig `json:"notifications"`
+
+	Delivery DeliveryConfig `json:"delivery"`
+}
+
+func DefaultStoreConfig() StoreConfig {
+	return StoreConfig{
+		ProductsFile:     "./produtos.json",
+		MaxPhotosPerTurn: 3,
+		DocumentsDir:     "./documentos",
+		CatalogFile:      "./Catalogo.pdf",
+		CEPFile:          "./ceps.json",
+		MessagesDir:      "./mensagens",
+		PaymentMethods:   DefaultPaymentMethods(),
+		BusinessHours: BusinessHoursConfig{
+			Timezone: "America/Sao_Paulo",
+		},
+		Approval: ApprovalConfig{
+			TimeoutMinutes: 15,
+			TimeoutAction:  ApprovalTimeoutEscalate,
+		},
+	}
+}
+
+// the config file is optional, missing keys keep the default values
+func LoadStoreConfig(path string) StoreConfig {
+	config := DefaultStoreConfig()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Config file %s not found, using defaults\n", path)
+		return config
+	}
+	failOnError(err, "Can't open config file")
+
+	err = json.Unmarshal(data, &config)
+	failOnError(err, "Can't parse config file")
+
+	err = ValidatePaymentMethods(config.PaymentMethods, config.PaymentGateway)
+	failOnError(err, "Invalid payment methods config")
+
+	err = config.BusinessHours.Validate()
+	failOnError(err, "Invalid business hours config")
+
+	err = config.DeliverySlots.Validate()
+	failOnError(err, "Invalid delivery slots config")
+
+	err = config.OrderRules.Validate()
+	failOnError(err, "Invalid order rules config")
+
+	err = ValidatePromotions(config.Promotions)
+	failOnError(err, "Invalid promotions config")
+
+	err = config.Notifications.Validate()
+	failOnError(err, "Invalid notifications config")
+
+	return config
+}
@@ -1,3 +1,49 @@
 package main
 
-// empty
+import (
+	"fmt"
+	"time"
+)
+
+const schedulerInterval = time.Minute
+
+type ScheduledJob struct {
+	Name string
+	Run  func()
+	// jobs that act on orders on their own wait for the store to open
+	OnlyWhenOpen bool
+}
+
+// delivery reminders run while closed, the first slot of the day is reminded before the opening
+var scheduledJobs = []ScheduledJob{
+	{Name: "approval timeouts", Run: CheckApprovalTimeouts, OnlyWhenOpen: true},
+	{Name: "delivery reminders", Run: SendDeliveryReminders},
+}
+
+// background jobs share the database connection with the message consumer, so they run under Vault.Lock
+func StartScheduler() {
+	for range time.Tick(schedulerInterval) {
+		open := Vault.Config.BusinessHours.IsOpen(time.Now())
+		for _, job := range scheduledJobs {
+			if job.OnlyWhenOpen && !open {
+				continue
+			}
+
+			runScheduledJob(job.Name, job.Run)
+		}
+	}
+}
+
+func runScheduledJob(name string, job func()) {
+	Vault.Lock.Lock()
+	defer Vault.Lock.Unlock()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			fmt.Printf("Scheduled job %s failed: %v\n", name, recovered)
+			NotifyError(fmt.Sprintf("Erro na tarefa agendada %s: %v", name, recovered), "")
+		}
+	}()
+
+	job()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/openai/openai-go"
+)
+
+const maxSavedAddresses = 5
+
+type Customer struct {
+	PhoneNumber      string
+	Name             string
+	Addresses        []Endereco
+	PreferredPayment string
+	Notes            string
+	OrderCount       int
+}
+
+type SavedAddressRequest struct {
+	Indice int `json:"indice"`
+}
+
+func LoadCustomer(phoneNumber string) *Customer {
+	row := Vault.PGX.QueryRow(
+		context.Background(),
+		"SELECT name, addresses, preferred_payment, notes, order_count FROM customers WHERE phone_number = $1",
+		phoneNumber,
+	)
+
+	customer, err := scanCustomer(row, phoneNumber)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	failOnError(err, "Can't load customer")
+
+	return customer
+}
+
+func scanCustomer(row pgx.Row, phoneNumber string) (*Customer, error) {
+	customer := Customer{PhoneNumber: phoneNumber}
+	var addresses []byte
+	var name, preferredPayment, notes *string
+
+	if err := row.Scan(&name, &addresses, &preferredPayment, &notes, &customer.OrderCount); err != nil {
+		return nil, err
+	}
+
+	if name != nil {
+		customer.Name = *name
+	}
+
+	if preferredPayment != nil {
+		customer.PreferredPayment = *preferredPayment
+	}
+
+	if notes != nil {
+		customer.Notes = *notes
+	}
+
+	if len(addresses) > 0 {
+		err := json.Unmarshal(addresses, &customer.Addresses)
+		failOnError(err, "Can't parse customer addresses")
+	}
+
+	return &customer, nil
+}
+
+// counts the order and keeps its address first, without duplicates. The stored row is updated in place so
+// a profile missing from the chat never overwrites the addresses, notes or count of the customer
+func RegisterCustomerOrder(phoneNumber string, order OrdemDeCompra) *Customer {
+	var address []byte
+	if order.EnderecoEstruturado != nil {
+		var err error
+		address, err = json.Marshal(order.EnderecoEstruturado)
+		failOnError(err, "Failed to marshal customer address")
+	}
+
+	row := Vault.PGX.QueryRow(
+		context.Background(),
+		`INSERT INTO customers (phone_number, name, addresses, preferred_payment, order_count, updated)
+		VALUES ($1, $2, CASE WHEN $3::jsonb IS NULL THEN '[]'::json ELSE json_build_array($3::jsonb) END, $4, 1, now())
+		ON CONFLICT (phone_number) DO UPDATE SET
+			name = EXCLUDED.name,
+			preferred_payment = EXCLUDED.preferred_payment,
+			order_count = customers.order_count + 1,
+			addresses = CASE WHEN $3::jsonb IS NULL THEN customers.addresses ELSE (
+				SELECT json_agg(merged.address ORDER BY merged.position)
+				FROM (
+					SELECT $3::jsonb AS address, 0 AS position
+					UNION ALL
+					(
+						SELECT saved.address::jsonb, saved.position
+						FROM json_array_elements(COALESCE(customers.addresses, '[]'::json)) WITH ORDINALITY AS saved(address, position)
+						WHERE saved.address::jsonb <> $3::jsonb
+						ORDER BY saved.position
+						LIMIT $5
+					)
+				) merged
+			) END,
+			updated = now()
+		RETURNING name, addresses, preferred_payment, notes, order_count`,
+		phoneNumber,
+		order.NomeCompleto,
+		address,
+		order.FormaDePagamento,
+		maxSavedAddresses-1,
+	)
+
+	customer, err := scanCustomer(row, phoneNumber)
+	failOnError(err, "Can't save customer")
+
+	return customer
+}
+
+// compact profile given to the model at the start of the conversation
+func (customer Customer) Profile() string {
+	lines := []string{
+		fmt.Sprintf("Este usuário já comprou conosco %d vez(es). Nome completo: %s.", customer.OrderCount, customer.Name),
+	}
+
+	if customer.PreferredPayment != "" {
+		lines = append(lines, fmt.Sprintf("Forma de pagamento preferida: %s.", customer.PreferredPayment))
+	}
+
+	if len(customer.Addresses) > 0 {
+		lines = append(lines, "Endereços salvos (ofereça antes de pedir um novo endereço e use usar_endereco_salvo quando o usuário escolher um):")
+		for i, address := range customer.Addresses {
+			lines = append(lines, fmt.Sprintf("%d) %s", i+1, address))
+		}
+	}
+
+	if customer.Notes != "" {
+		lines = append(lines, fmt.Sprintf("Observações: %s", customer.Notes))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func pickSavedAddressTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "usar_endereco_salvo",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Usa um dos endereços salvos do usuário como endereço de entrega. Deve ser chamado quando o usuário escolher um endereço salvo, não é necessário chamar validar_endereco depois."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"indice",
+				},
+				"properties": map[string]interface{}{
+					"indice": map[string]string{
+						"type":        "integer",
+						"description": "Número do endereço salvo escolhido, começando em 1",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) PickSavedAddress(request SavedAddressRequest) string {
+	if chat.Customer == nil || request.Indice < 1 || request.Indice > len(chat.Customer.Addresses) {
+		return "endereço salvo não encontrado, peça o endereço ao usuário"
+	}
+
+	address := chat.Customer.Addresses[request.Indice-1]
+	chat.PendingAddress = nil
+	chat.ConfirmedAddress = &address
+	chat.Delivery = nil
+	return fmt.Sprintf("endereço de entrega definido: %s", address)
+}
@@ -93,13 +93,97 @@ ALTER TABLE assist.suspended_chats OWNER TO postgres;
 CREATE TABLE assist.orders (
     id serial NOT NULL,
     phone_number character varying NOT NULL,
-    data json
-    created timestamp
+    data json,
+    created timestamp without time zone DEFAULT now() NOT NULL,
+    status character varying DEFAULT 'recebido'::character varying NOT NULL,
+    updated timestamp without time zone DEFAULT now() NOT NULL,
+    version integer DEFAULT 1 NOT NULL,
+    delivery_slot timestamp with time zone,
+    slot_reminded boolean DEFAULT false NOT NULL,
+    paid boolean DEFAULT false NOT NULL
 );
 
 
 ALTER TABLE assist.orders OWNER TO postgres;
 
+--
+-- Name: order_versions; Type: TABLE; Schema: assist; Owner: postgres
+--
+
+CREATE TABLE assist.order_versions (
+    order_id integer NOT NULL,
+    version integer NOT NULL,
+    status character varying NOT NULL,
+    data json,
+    created timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE assist.order_versions OWNER TO postgres;
+
+--
+-- Name: customers; Type: TABLE; Schema: assist; Owner: postgres
+--
+
+CREATE TABLE assist.customers (
+    phone_number character varying NOT NULL,
+    name character varying,
+    addresses json,
+    preferred_payment character varying,
+    notes text,
+    order_count integer DEFAULT 0 NOT NULL,
+    updated timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE assist.customers OWNER TO postgres;
+
+--
+-- Name: payments; Type: TABLE; Schema: assist; Owner: postgres
+--
+
+CREATE TABLE assist.payments (
+    order_id integer NOT NULL,
+    provider_id character varying NOT NULL,
+    payment_id character varying,
+    status character varying NOT NULL,
+    amount bigint NOT NULL,
+    link character varying,
+    created timestamp without time zone DEFAULT now() NOT NULL,
+    updated timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE assist.payments OWNER TO postgres;
+
+--
+-- Name: coupon_redemptions; Type: TABLE; Schema: assist; Owner: postgres
+--
+
+CREATE TABLE assist.coupon_redemptions (
+    promotion_id character varying NOT NULL,
+    phone_number character varying NOT NULL,
+    order_id integer NOT NULL,
+    created timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE assist.coupon_redemptions OWNER TO postgres;
+
+--
+-- Name: stock; Type: TABLE; Schema: assist; Owner: postgres
+--
+
+CREATE TABLE assist.stock (
+    product_id character varying NOT NULL,
+    variant character varying DEFAULT ''::character varying NOT NULL,
+    quantity integer NOT NULL,
+    updated timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE assist.stock OWNER TO postgres;
+
 --
 -- TOC entry 3218 (class 2606 OID 24761)
 -- Name: chat_logs chat_logs_pk; Type: CONSTRAINT; Schema: assist; Owner: postgres
@@ -124,6 +208,41 @@ ALTER TABLE ONLY assist.suspended_chats
 ALTER TABLE ONLY assist.orders
     ADD CONSTRAINT orders_pk PRIMARY KEY (id, phone_number);
 
+--
+-- Name: order_versions order_versions_pk; Type: CONSTRAINT; Schema: assist; Owner: postgres
+--
+
+ALTER TABLE ONLY assist.order_versions
+    ADD CONSTRAINT order_versions_pk PRIMARY KEY (order_id, version);
+
+--
+-- Name: customers customers_pk; Type: CONSTRAINT; Schema: assist; Owner: postgres
+--
+
+ALTER TABLE ONLY assist.customers
+    ADD CONSTRAINT customers_pk PRIMARY KEY (phone_number);
+
+--
+-- Name: payments payments_pk; Type: CONSTRAINT; Schema: assist; Owner: postgres
+--
+
+ALTER TABLE ONLY assist.payments
+    ADD CONSTRAINT payments_pk PRIMARY KEY (provider_id);
+
+--
+-- Name: coupon_redemptions coupon_redemptions_pk; Type: CONSTRAINT; Schema: assist; Owner: postgres
+--
+
+ALTER TABLE ONLY assist.coupon_redemptions
+    ADD CONSTRAINT coupon_redemptions_pk PRIMARY KEY (promotion_id, order_id);
+
+--
+-- Name: stock stock_pk; Type: CONSTRAINT; Schema: assist; Owner: postgres
+--
+
+ALTER TABLE ONLY assist.stock
+    ADD CONSTRAINT stock_pk PRIMARY KEY (product_id, variant);
+
 
 -- Completed on 2025-05-01 19:01:12
 
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+type DeliveryConfig struct {
+	StoreLatitude  float64        `json:"store_latitude"`
+	StoreLongitude float64        `json:"store_longitude"`
+	FreeAbove      Money          `json:"free_above"`
+	Zones          []DeliveryZone `json:"zones"`
+}
+
+type DeliveryZone struct {
+	Name           string         `json:"name"`
+	Neighbourhoods []string       `json:"neighbourhoods"`
+	CEPPrefixes    []string       `json:"cep_prefixes"`
+	MaxDistanceKm  float64        `json:"max_distance_km"`
+	Fee            Money          `json:"fee"`
+	Tiers          []DeliveryTier `json:"tiers"`
+	FreeAbove      Money          `json:"free_above"`
+}
+
+// fee for distances up to UpToKm, tiers are checked in order
+type DeliveryTier struct {
+	UpToKm float64 `json:"up_to_km"`
+	Fee    Money   `json:"fee"`
+}
+
+type DeliveryQuote struct {
+	Zone       string
+	Bairro     string
+	CEP        string
+	DistanceKm float64
+	Fee        Money
+	FreeAbove  Money
+}
+
+type DeliveryRequest struct {
+	Bairro          string `json:"bairro"`
+	CEP             string `json:"cep"`
+	UsarLocalizacao bool   `json:"usar_localizacao"`
+	ValorProdutos   string `json:"valor_produtos"`
+}
+
+var nonDigits = regexp.MustCompile(`\D`)
+
+var accentReplacer = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "ê", "e", "è", "e", "ë", "e",
+	"í", "i", "î", "i", "ì", "i", "ï", "i",
+	"ó", "o", "ô", "o", "õ", "o", "ò", "o", "ö", "o",
+	"ú", "u", "û", "u", "ù", "u", "ü", "u",
+	"ç", "c",
+)
+
+// lower case without accents and repeated spaces, used to compare user input
+func normalizeText(text string) string {
+	text = accentReplacer.Replace(strings.ToLower(text))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func (config DeliveryConfig) Enabled() bool {
+	return len(config.Zones) > 0
+}
+
+// finds the first zone matching the neighbourhood, cep prefix or distance from the store
+func (config DeliveryConfig) Quote(bairro string, cep string, location *EvolutionLocation) (DeliveryQuote, error) {
+	cep = nonDigits.ReplaceAllString(cep, "")
+	distance := -1.0
+	if location != nil && (config.StoreLatitude != 0 || config.StoreLongitude != 0) {
+		distance = haversineKm(config.StoreLatitude, config.StoreLongitude, location.DegreesLatitude, location.DegreesLongitude)
+	}
+
+	for _, zone := range config.Zones {
+		if !zone.Matches(bairro, cep, distance) {
+			continue
+		}
+
+		quote := DeliveryQuote{
+			Zone:       zone.Name,
+			Bairro:     bairro,
+			CEP:        cep,
+			DistanceKm: distance,
+			Fee:        zone.Fee,
+			FreeAbove:  config.FreeAbove,
+		}
+
+		if zone.FreeAbove > 0 {
+			quote.FreeAbove = zone.FreeAbove
+		}
+
+		if len(zone.Tiers) > 0 {
+			if distance < 0 {
+				return DeliveryQuote{}, fmt.Errorf("a taxa da região %s depende da distância, peça ao usuário para compartilhar a localização", zone.Name)
+			}
+
+			index := slices.IndexFunc(zone.Tiers, func(tier DeliveryTier) bool { return distance <= tier.UpToKm })
+			if index < 0 {
+				return DeliveryQuote{}, fmt.Errorf("endereço a %.1f km fora da área de entrega", distance)
+			}
+			quote.Fee = zone.Tiers[index].Fee
+		}
+
+		return quote, nil
+	}
+
+	return DeliveryQuote{}, fmt.Errorf("endereço fora da área de entrega")
+}
+
+func (zone DeliveryZone) Matches(bairro string, cep string, distance float64) bool {
+	if bairro != "" && slices.ContainsFunc(zone.Neighbourhoods, func(name string) bool {
+		return normalizeText(name) == normalizeText(bairro)
+	}) {
+		return true
+	}
+
+	if cep != "" && slices.ContainsFunc(zone.CEPPrefixes, func(prefix string) bool {
+		return strings.HasPrefix(cep, nonDigits.ReplaceAllString(prefix, ""))
+	}) {
+		return true
+	}
+
+	if distance < 0 {
+		return false
+	}
+
+	if zone.MaxDistanceKm > 0 {
+		return distance <= zone.MaxDistanceKm
+	}
+
+	// zones priced only by distance tiers cover the distances listed in them
+	return len(zone.Neighbourhoods) == 0 && len(zone.CEPPrefixes) == 0 && len(zone.Tiers) > 0
+}
+
+func (quote DeliveryQuote) FeeFor(subtotal Money) Money {
+	if quote.FreeAbove > 0 && subtotal >= quote.FreeAbove {
+		return 0
+	}
+
+	return quote.Fee
+}
+
+func haversineKm(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	toRad := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func calculateDeliveryTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "calcular_frete",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Calcula a taxa de entrega para o endereço do usuário. Deve ser chamado assim que o endereço for informado e antes de finalizar_checkout. Informe a taxa separada do valor dos produtos."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"bairro",
+					"cep",
+					"usar_localizacao",
+					"valor_produtos",
+				},
+				"properties": map[string]interface{}{
+					"bairro": map[string]string{
+						"type":        "string",
+						"description": "Bairro do endereço de entrega, vazio se desconhecido",
+					},
+					"cep": map[string]string{
+						"type":        "string",
+						"description": "CEP do endereço de entrega, vazio se desconhecido",
+					},
+					"usar_localizacao": map[string]string{
+						"type":        "boolean",
+						"description": "Verdadeiro quando o usuário compartilhou a localização de entrega",
+					},
+					"valor_produtos": map[string]string{
+						"type":        "string",
+						"description": "Soma do valor dos produtos no carrinho, sem a entrega",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// the fee of the order always comes from the confirmed address, whatever calcular_frete was called with
+func (chat *WhatsAppChat) QuoteConfirmedAddress() error {
+	chat.Delivery = nil
+	if !Vault.Config.Delivery.Enabled() || chat.ConfirmedAddress == nil {
+		return nil
+	}
+
+	quote, err := Vault.Config.Delivery.Quote(chat.ConfirmedAddress.Bairro, chat.ConfirmedAddress.CEP, chat.SharedLocation)
+	if err != nil {
+		return err
+	}
+
+	chat.Delivery = &quote
+	return nil
+}
+
+func (chat *WhatsAppChat) CalculateDelivery(request DeliveryRequest) string {
+	var location *EvolutionLocation
+	if request.UsarLocalizacao {
+		location = chat.SharedLocation
+	}
+
+	quote, err := Vault.Config.Delivery.Quote(request.Bairro, request.CEP, location)
+	if err != nil {
+		chat.Delivery = nil
+		return fmt.Sprintf("não é possível entregar: %s", err)
+	}
+
+	chat.Delivery = &quote
+	subtotal, _ := ParseMoney(request.ValorProdutos)
+	fee := quote.FeeFor(subtotal)
+
+	result := fmt.Sprintf("região %s, taxa de entrega %s", quote.Zone, fee)
+	if fee == 0 && quote.Fee > 0 {
+		result = fmt.Sprintf("região %s, entrega grátis para pedidos acima de %s", quote.Zone, quote.FreeAbove)
+	} else if quote.FreeAbove > 0 {
+		result = fmt.Sprintf("%s, grátis para pedidos acima de %s", result, quote.FreeAbove)
+	}
+
+	return result
+}
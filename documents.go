@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	documentIndexFile       = "documentos.json"
+	documentsReloadInterval = 10 * time.Second
+)
+
+type CatalogDocument struct {
+	Nome      string `json:"nome"`
+	Arquivo   string `json:"arquivo"`
+	Descricao string `json:"descricao"`
+	MimeType  string `json:"mimetype"`
+	content   []byte
+}
+
+type SentDocument struct {
+	Nome     string
+	Arquivo  string
+	SendTime time.Time
+}
+
+type DocumentStore struct {
+	mu           sync.RWMutex
+	dir          string
+	fallbackFile string
+	documents    []CatalogDocument
+	signature    string
+}
+
+type DocumentRequest struct {
+	Nome     string `json:"nome"`
+	Reenviar bool   `json:"reenviar"`
+}
+
+func LoadDocumentStore(dir string, fallbackFile string) *DocumentStore {
+	store := &DocumentStore{
+		dir:          dir,
+		fallbackFile: fallbackFile,
+	}
+
+	err := store.Reload()
+	failOnError(err, "Can't load documents")
+
+	return store
+}
+
+// reloads the documents when any file in the directory changes
+func (store *DocumentStore) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if !store.changed() {
+			continue
+		}
+
+		if err := store.Reload(); err != nil {
+			fmt.Printf("Warning: can't reload documents: %s\n", err)
+			continue
+		}
+
+		fmt.Printf("Documents reloaded: %s\n", strings.Join(store.Names(), ", "))
+	}
+}
+
+func (store *DocumentStore) changed() bool {
+	signature := dirSignature(store.dir)
+
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return signature != store.signature
+}
+
+func (store *DocumentStore) Reload() error {
+	signature := dirSignature(store.dir)
+
+	documents, err := store.readDocuments()
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.documents = documents
+	store.signature = signature
+
+	return nil
+}
+
+func (store *DocumentStore) readDocuments() ([]CatalogDocument, error) {
+	entries, err := os.ReadDir(store.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return store.readFallback()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// optional metadata, files without an entry are named after the file
+	indexed := []CatalogDocument{}
+	indexData, err := os.ReadFile(filepath.Join(store.dir, documentIndexFile))
+	if err == nil {
+		if err := json.Unmarshal(indexData, &indexed); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", documentIndexFile, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	documents := []CatalogDocument{}
+	names := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == documentIndexFile || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		document := CatalogDocument{
+			Nome:    strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))),
+			Arquivo: entry.Name(),
+		}
+
+		if index := slices.IndexFunc(indexed, func(meta CatalogDocument) bool { return meta.Arquivo == entry.Name() }); index >= 0 {
+			meta := indexed[index]
+			if meta.Nome != "" {
+				document.Nome = meta.Nome
+			}
+			document.Descricao = meta.Descricao
+			document.MimeType = meta.MimeType
+		}
+
+		// the names are the enum of enviar_documento
+		key := strings.ToLower(document.Nome)
+		if other, found := names[key]; found {
+			return nil, fmt.Errorf("files %s and %s are both named %s", other, entry.Name(), document.Nome)
+		}
+		names[key] = entry.Name()
+
+		if document.MimeType == "" {
+			document.MimeType = mime.TypeByExtension(strings.ToLower(filepath.Ext(entry.Name())))
+		}
+
+		document.content, err = os.ReadFile(filepath.Join(store.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+// keeps the single catalog pdf working when there is no documents directory
+func (store *DocumentStore) readFallback() ([]CatalogDocument, error) {
+	content, err := os.ReadFile(store.fallbackFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return []CatalogDocument{
+		{
+			Nome:      "catalogo",
+			Arquivo:   filepath.Base(store.fallbackFile),
+			Descricao: "Catálogo de produtos",
+			MimeType:  "application/pdf",
+			content:   content,
+		},
+	}, nil
+}
+
+// names, sizes and modification times of the files, changes when any file changes
+func dirSignature(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	parts := []string{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+
+	return strings.Join(parts, "|")
+}
+
+func (store *DocumentStore) Names() []string {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	names := []string{}
+	for _, document := range store.documents {
+		names = append(names, document.Nome)
+	}
+
+	return names
+}
+
+func (store *DocumentStore) Find(name string) (CatalogDocument, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	for _, document := range store.documents {
+		if strings.EqualFold(document.Nome, name) {
+			return document, true
+		}
+	}
+
+	return CatalogDocument{}, false
+}
+
+func (store *DocumentStore) Describe() string {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	lines := []string{}
+	for _, document := range store.documents {
+		line := document.Nome
+		if document.Descricao != "" {
+			line = fmt.Sprintf("%s: %s", line, document.Descricao)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "; ")
+}
+
+func sendDocumentTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "enviar_documento",
+			Strict:      openai.Bool(true),
+			Description: openai.String(fmt.Sprintf("Envia um documento para o usuário quando pedido, como o catálogo. Documentos disponíveis: %s", Vault.Documents.Describe())),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"nome",
+					"reenviar",
+				},
+				"properties": map[string]interface{}{
+					"nome": map[string]interface{}{
+						"type":        "string",
+						"description": "Nome do documento a ser enviado",
+						"enum":        Vault.Documents.Names(),
+					},
+					"reenviar": map[string]string{
+						"type":        "boolean",
+						"description": "Verdadeiro quando o usuário pedir de novo um documento já enviado nesta conversa",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) SendDocument(request DocumentRequest) string {
+	document, found := Vault.Documents.Find(request.Nome)
+	if !found {
+		return fmt.Sprintf("documento %s não encontrado", request.Nome)
+	}
+
+	// the same document is sent once per conversation unless the user asks for it again
+	if index := slices.IndexFunc(chat.SentDocuments, func(sent SentDocument) bool { return sent.Nome == document.Nome }); index >= 0 && !request.Reenviar {
+		return fmt.Sprintf("documento %s já foi enviado às %s, pergunte se o usuário quer receber novamente", document.Nome, chat.SentDocuments[index].SendTime.Format("15:04"))
+	}
+
+	chat.SendDocToWhatsapp(document.content, document.MimeType, document.Arquivo)
+	chat.SentDocuments = append(chat.SentDocuments, SentDocument{
+		Nome:     document.Nome,
+		Arquivo:  document.Arquivo,
+		SendTime: time.Now(),
+	})
+
+	return fmt.Sprintf("documento %s enviado", document.Nome)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type EvolutionSendResponse struct {
+	Key EvolutionMessageKey `json:"key"`
+}
+
+func EvolutionPost(path string, payload any) (int, []byte) {
+	status, resBody, err := EvolutionRequest(path, payload)
+	failOnError(err, "Can't send message to evolution api")
+
+	return status, resBody
+}
+
+func EvolutionRequest(path string, payload any) (int, []byte, error) {
+	body, _ := json.Marshal(payload)
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		fmt.Sprintf("%s/%s/%s", Vault.EvolutionURL, path, Vault.InstanceID),
+		bytes.NewBuffer(body),
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	req.Header.Add("apikey", Vault.EvolutionToken)
+	req.Header.Add("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, nil, err
+	}
+
+	return res.StatusCode, resBody, nil
+}
+
+// message id of a send response, used to match quoted replies later
+func sentMessageID(resBody []byte) string {
+	var sent EvolutionSendResponse
+	if err := json.Unmarshal(resBody, &sent); err != nil {
+		return ""
+	}
+
+	return sent.Key.ID
+}
+
+func (chat WhatsAppChat) SendMessageToWhatsApp(message string) string {
+	return SendMessageToNumber(chat.Number, message)
+}
+
+// formats the model reply and sends it in parts, returns the id of the first part
+func (chat WhatsAppChat) SendReplyToWhatsApp(reply string, stopTyping func()) string {
+	var firstID string
+
+	parts := SplitMessage(FormatForWhatsApp(reply), maxMessageLength)
+	for i, part := range parts {
+		if i > 0 {
+			chat.SendPresence("composing", time.Second)
+			time.Sleep(time.Second)
+		}
+
+		time.Sleep(TypingDelay(part))
+		if i == len(parts)-1 {
+			stopTyping()
+		}
+
+		messageID := chat.SendMessageToWhatsApp(part)
+		if firstID == "" {
+			firstID = messageID
+		}
+	}
+
+	return firstID
+}
+
+func (chat WhatsAppChat) SendDocToWhatsapp(file []byte, mimeType string, fileName string) string {
+	return SendMediaToNumber(chat.Number, file, "document", mimeType, fileName, "", true)
+}
+
+func SendMediaToNumber(number string, file []byte, mediatype string, mimeType string, fileName string, caption string, encodeBase64 bool) string {
+	doc := string(file)
+	if encodeBase64 {
+		doc = base64.StdEncoding.EncodeToString(file)
+	}
+
+	_, resBody := EvolutionPost("message/sendMedia", map[string]string{
+		"number":    number,
+		"mimetype":  mimeType,
+		"mediatype": mediatype,
+		"fileName":  fileName,
+		"caption":   caption,
+		"media":     doc,
+	})
+
+	fmt.Printf("Media sent to whatsapp (%s): %s\n", number, fileName)
+	return sentMessageID(resBody)
+}
+
+func SendMessageToNumber(number string, message string) string {
+	_, resBody := EvolutionPost("message/sendText", map[string]string{
+		"number": number,
+		"text":   message,
+	})
+
+	fmt.Printf("Message sent to whatsapp (%s): %s\n", number, message)
+	return sentMessageID(resBody)
+}
+
+func GetMediaBase64(key string) EvolutionMedia {
+	_, resBody := EvolutionPost("chat/getBase64FromMediaMessage", map[string]any{
+		"message": map[string]any{
+			"key": map[string]string{
+				"id": key,
+			},
+		},
+		"convertToMp4": false,
+	})
+
+	var respData EvolutionMedia
+	json.Unmarshal(resBody, &respData)
+
+	return respData
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+const maxMessageLength = 1500
+
+var (
+	markdownHeading       = regexp.MustCompile(`(?m)^[ \t]{0,3}#{1,6}[ \t]+(.+?)[ \t]*#*[ \t]*$`)
+	markdownBold          = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	markdownItalic        = regexp.MustCompile(`(^|[^\w*])\*(\S(?:[^*\n]*?\S)?)\*([^\w*]|$)`)
+	markdownStrike        = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	markdownLink          = regexp.MustCompile(`\[([^\]]+)\]\((\S+?)\)`)
+	markdownBullet        = regexp.MustCompile(`(?m)^([ \t]*)[-*+][ \t]+`)
+	markdownRule          = regexp.MustCompile(`(?m)^[ \t]*(?:-{3,}|\*{3,}|_{3,})[ \t]*$`)
+	markdownTableDivider  = regexp.MustCompile(`^\s*\|?\s*:?-{2,}:?\s*(\|\s*:?-{2,}:?\s*)*\|?\s*$`)
+	markdownExtraNewlines = regexp.MustCompile(`\n{3,}`)
+)
+
+// converts the markdown produced by the model to whatsapp syntax
+func FormatForWhatsApp(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = formatTables(text)
+
+	// bold goes through a placeholder so it isn't taken as italic
+	text = markdownBold.ReplaceAllStringFunc(text, func(match string) string {
+		groups := markdownBold.FindStringSubmatch(match)
+		return "\x00" + groups[1] + groups[2] + "\x00"
+	})
+	text = markdownHeading.ReplaceAllStringFunc(text, func(match string) string {
+		groups := markdownHeading.FindStringSubmatch(match)
+		return "\x00" + strings.ReplaceAll(groups[1], "\x00", "") + "\x00"
+	})
+	text = markdownRule.ReplaceAllString(text, "")
+	text = markdownBullet.ReplaceAllString(text, "$1• ")
+	text = markdownItalic.ReplaceAllString(text, "${1}_${2}_${3}")
+	text = strings.ReplaceAll(text, "\x00", "*")
+	text = markdownStrike.ReplaceAllString(text, "~$1~")
+	text = markdownLink.ReplaceAllStringFunc(text, func(match string) string {
+		groups := markdownLink.FindStringSubmatch(match)
+		if groups[1] == groups[2] {
+			return groups[2]
+		}
+
+		return groups[1] + " (" + groups[2] + ")"
+	})
+	text = markdownExtraNewlines.ReplaceAllString(text, "\n\n")
+
+	return strings.TrimSpace(text)
+}
+
+// tables are not supported, each row becomes a line with the cells separated by dashes
+func formatTables(text string) string {
+	lines := strings.Split(text, "\n")
+	formatted := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "|") || strings.Count(trimmed, "|") < 2 {
+			formatted = append(formatted, line)
+			continue
+		}
+
+		if markdownTableDivider.MatchString(trimmed) {
+			continue
+		}
+
+		cells := []string{}
+		for _, cell := range strings.Split(strings.Trim(trimmed, "|"), "|") {
+			if cell = strings.TrimSpace(cell); cell != "" {
+				cells = append(cells, cell)
+			}
+		}
+
+		formatted = append(formatted, strings.Join(cells, " - "))
+	}
+
+	return strings.Join(formatted, "\n")
+}
+
+// splits a reply on paragraph boundaries, each part with at most maxLength characters
+func SplitMessage(text string, maxLength int) []string {
+	parts := []string{}
+	current := ""
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+
+		if current != "" && runeLen(current)+2+runeLen(paragraph) <= maxLength {
+			current += "\n\n" + paragraph
+			continue
+		}
+
+		if current != "" {
+			parts = append(parts, current)
+		}
+
+		current = ""
+		for _, chunk := range splitLongText(paragraph, maxLength) {
+			if current != "" {
+				parts = append(parts, current)
+			}
+			current = chunk
+		}
+	}
+
+	if current != "" {
+		parts = append(parts, current)
+	}
+
+	return parts
+}
+
+// breaks a single paragraph by lines, then by words and as last resort by characters
+func splitLongText(text string, maxLength int) []string {
+	if runeLen(text) <= maxLength {
+		return []string{text}
+	}
+
+	for _, separator := range []string{"\n", " "} {
+		if !strings.Contains(text, separator) {
+			continue
+		}
+
+		chunks := []string{}
+		current := ""
+		for _, piece := range strings.Split(text, separator) {
+			if current != "" && runeLen(current)+runeLen(separator)+runeLen(piece) <= maxLength {
+				current += separator + piece
+				continue
+			}
+
+			if current != "" {
+				chunks = append(chunks, current)
+			}
+
+			if runeLen(piece) > maxLength {
+				sub := splitLongText(piece, maxLength)
+				chunks = append(chunks, sub[:len(sub)-1]...)
+				piece = sub[len(sub)-1]
+			}
+			current = piece
+		}
+
+		if current != "" {
+			chunks = append(chunks, current)
+		}
+
+		return chunks
+	}
+
+	runes := []rune(text)
+	chunks := []string{}
+	for len(runes) > maxLength {
+		chunks = append(chunks, string(runes[:maxLength]))
+		runes = runes[maxLength:]
+	}
+
+	return append(chunks, string(runes))
+}
+
+func runeLen(text string) int {
+	return len([]rune(text))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFormatForWhatsApp(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "heading",
+			in:   "### Resumo do pedido\nWhey Protein 900g",
+			want: "*Resumo do pedido*\nWhey Protein 900g",
+		},
+		{
+			name: "heading with bold",
+			in:   "## **Formas de pagamento**",
+			want: "*Formas de pagamento*",
+		},
+		{
+			name: "bold and italic",
+			in:   "O total é **R$ 129,90** e a entrega é *grátis*.",
+			want: "O total é *R$ 129,90* e a entrega é _grátis_.",
+		},
+		{
+			name: "underscore bold",
+			in:   "__Atenção__: pedido sujeito a aprovação",
+			want: "*Atenção*: pedido sujeito a aprovação",
+		},
+		{
+			name: "strike",
+			in:   "De ~~R$ 150,00~~ por R$ 129,90",
+			want: "De ~R$ 150,00~ por R$ 129,90",
+		},
+		{
+			name: "link with label",
+			in:   "Pague pelo [link de pagamento](https://example.com/pagar/1).",
+			want: "Pague pelo link de pagamento (https://example.com/pagar/1).",
+		},
+		{
+			name: "link with url label",
+			in:   "[https://example.com](https://example.com)",
+			want: "https://example.com",
+		},
+		{
+			name: "bullet list",
+			in:   "Sabores disponíveis:\n- Chocolate\n* Morango\n+ Baunilha",
+			want: "Sabores disponíveis:\n• Chocolate\n• Morango\n• Baunilha",
+		},
+		{
+			name: "nested list with bold",
+			in:   "- **Whey**\n  - Chocolate\n  - Morango",
+			want: "• *Whey*\n  • Chocolate\n  • Morango",
+		},
+		{
+			name: "numbered list is kept",
+			in:   "1. Pix\n2. Cartão na entrega",
+			want: "1. Pix\n2. Cartão na entrega",
+		},
+		{
+			name: "horizontal rule and extra newlines",
+			in:   "Pedido confirmado\n\n---\n\n\n\nObrigado!",
+			want: "Pedido confirmado\n\nObrigado!",
+		},
+		{
+			name: "table",
+			in:   "| Produto | Preço |\n|---|:---:|\n| Whey | R$ 129,90 |\n| Creatina | R$ 89,90 |",
+			want: "Produto - Preço\nWhey - R$ 129,90\nCreatina - R$ 89,90",
+		},
+		{
+			name: "windows newlines",
+			in:   "**Total**\r\nR$ 10,00",
+			want: "*Total*\nR$ 10,00",
+		},
+		{
+			name: "multiplication is not italic",
+			in:   "2 * 3 unidades",
+			want: "2 * 3 unidades",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FormatForWhatsApp(test.in); got != test.want {
+				t.Errorf("FormatForWhatsApp(%q) = %q, want %q", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		maxLength int
+		want      []string
+	}{
+		{
+			name:      "short message",
+			in:        "Olá! Como posso ajudar?",
+			maxLength: 50,
+			want:      []string{"Olá! Como posso ajudar?"},
+		},
+		{
+			name:      "paragraphs joined while they fit",
+			in:        "primeiro\n\nsegundo\n\nterceiro",
+			maxLength: 17,
+			want:      []string{"primeiro\n\nsegundo", "terceiro"},
+		},
+		{
+			name:      "empty paragraphs are dropped",
+			in:        "\n\nprimeiro\n\n\n\n  \n\nsegundo\n\n",
+			maxLength: 8,
+			want:      []string{"primeiro", "segundo"},
+		},
+		{
+			name:      "long paragraph after a short one",
+			in:        "curto\n\numa frase longa demais",
+			maxLength: 10,
+			want:      []string{"curto", "uma frase", "longa", "demais"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SplitMessage(test.in, test.maxLength); !slices.Equal(got, test.want) {
+				t.Errorf("SplitMessage(%q, %d) = %q, want %q", test.in, test.maxLength, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitMessageLongText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"no break points", strings.Repeat("a", 4000)},
+		{"multibyte without break points", strings.Repeat("ção", 1200)},
+		{"emoji without break points", strings.Repeat("🍫", 3100)},
+		{"words", strings.Repeat("proteína ", 500)},
+		{"lines", strings.Repeat("• Whey Protein 900g chocolate\n", 120)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parts := SplitMessage(test.in, maxMessageLength)
+			if len(parts) < 2 {
+				t.Fatalf("expected the text to be split, got %d parts", len(parts))
+			}
+
+			for _, part := range parts {
+				if !utf8.ValidString(part) {
+					t.Errorf("part is not valid utf-8: %q", part)
+				}
+				if runeLen(part) > maxMessageLength {
+					t.Errorf("part has %d characters, limit is %d", runeLen(part), maxMessageLength)
+				}
+			}
+
+			joined := strings.Join(parts, "")
+			if strings.Join(strings.Fields(joined), "") != strings.Join(strings.Fields(test.in), "") {
+				t.Errorf("split lost or changed characters")
+			}
+		})
+	}
+}
+
+func TestSplitLongText(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		maxLength int
+		want      []string
+	}{
+		{
+			name:      "fits",
+			in:        "curto",
+			maxLength: 10,
+			want:      []string{"curto"},
+		},
+		{
+			name:      "lines before words",
+			in:        "linha um\nlinha dois",
+			maxLength: 12,
+			want:      []string{"linha um", "linha dois"},
+		},
+		{
+			name:      "words",
+			in:        "um dois três quatro",
+			maxLength: 8,
+			want:      []string{"um dois", "três", "quatro"},
+		},
+		{
+			name:      "long word inside a line",
+			in:        "ok abcdefghij",
+			maxLength: 4,
+			want:      []string{"ok", "abcd", "efgh", "ij"},
+		},
+		{
+			name:      "characters",
+			in:        "abcdefghij",
+			maxLength: 4,
+			want:      []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:      "multibyte at the boundary",
+			in:        "açãoçãoé",
+			maxLength: 3,
+			want:      []string{"açã", "oçã", "oé"},
+		},
+		{
+			name:      "emoji at the boundary",
+			in:        "ab🍫🍫c",
+			maxLength: 3,
+			want:      []string{"ab🍫", "🍫c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := splitLongText(test.in, test.maxLength); !slices.Equal(got, test.want) {
+				t.Errorf("splitLongText(%q, %d) = %q, want %q", test.in, test.maxLength, got, test.want)
+			}
+		})
+	}
+}
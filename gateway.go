@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	GatewayMercadoPago = "mercadopago"
+	GatewayStub        = "stub"
+
+	PaymentPending  = "pending"
+	PaymentApproved = "approved"
+	PaymentRejected = "rejected"
+	// local status of charges replaced after an amendment
+	PaymentCancelled = "cancelled"
+)
+
+type PaymentGatewayConfig struct {
+	Provider        string `json:"provider"`
+	BaseURL         string `json:"base_url"`
+	AccessToken     string `json:"access_token"`
+	WebhookSecret   string `json:"webhook_secret"`
+	NotificationURL string `json:"notification_url"`
+	StubAddr        string `json:"stub_addr"`
+}
+
+type Charge struct {
+	OrderID     int
+	Description string
+	Amount      Money
+}
+
+type ChargeLink struct {
+	ID  string
+	URL string
+}
+
+type PaymentStatus struct {
+	ID      string
+	Status  string
+	OrderID int
+	Amount  Money
+}
+
+type PaymentProvider interface {
+	CreateCharge(charge Charge) (ChargeLink, error)
+	// returns the provider payment id notified by the webhook, empty when the notification is not about a payment
+	ParseWebhook(request *http.Request, body []byte) (string, error)
+	Status(paymentID string) (PaymentStatus, error)
+}
+
+// checkout pro api, https://www.mercadopago.com.br/developers
+type MercadoPagoProvider struct {
+	BaseURL         string
+	AccessToken     string
+	WebhookSecret   string
+	NotificationURL string
+	client          *http.Client
+}
+
+func (config PaymentGatewayConfig) Enabled() bool {
+	return config.Provider != ""
+}
+
+func NewPaymentProvider(config PaymentGatewayConfig) PaymentProvider {
+	switch config.Provider {
+	case "":
+		return nil
+	case GatewayStub:
+		config.BaseURL = StartPaymentStub(config.StubAddr, config.WebhookSecret)
+	case GatewayMercadoPago:
+	default:
+		failOnError(fmt.Errorf("unknown provider %s", config.Provider), "Invalid payment gateway config")
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.mercadopago.com"
+	}
+
+	return &MercadoPagoProvider{
+		BaseURL:         strings.TrimSuffix(config.BaseURL, "/"),
+		AccessToken:     config.AccessToken,
+		WebhookSecret:   config.WebhookSecret,
+		NotificationURL: config.NotificationURL,
+		client:          &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (provider *MercadoPagoProvider) request(method string, path string, payload any, response any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequest(method, provider.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+provider.AccessToken)
+	request.Header.Set("Content-Type", "application/json")
+
+	res, err := provider.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s %s returned %d: %s", method, path, res.StatusCode, resBody)
+	}
+
+	return json.Unmarshal(resBody, response)
+}
+
+func (provider *MercadoPagoProvider) CreateCharge(charge Charge) (ChargeLink, error) {
+	var preference struct {
+		ID        string `json:"id"`
+		InitPoint string `json:"init_point"`
+	}
+
+	err := provider.request(http.MethodPost, "/checkout/preferences", map[string]any{
+		"items": []map[string]any{
+			{
+				"title":       charge.Description,
+				"quantity":    1,
+				"unit_price":  float64(charge.Amount) / 100,
+				"currency_id": "BRL",
+			},
+		},
+		"external_reference": strconv.Itoa(charge.OrderID),
+		"notification_url":   provider.NotificationURL,
+	}, &preference)
+	if err != nil {
+		return ChargeLink{}, err
+	}
+
+	return ChargeLink{ID: preference.ID, URL: preference.InitPoint}, nil
+}
+
+func (provider *MercadoPagoProvider) ParseWebhook(request *http.Request, body []byte) (string, error) {
+	var notification struct {
+		Type string `json:"type"`
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return "", err
+	}
+
+	if notification.Type != "payment" {
+		return "", nil
+	}
+
+	paymentID := request.URL.Query().Get("data.id")
+	if paymentID == "" {
+		paymentID = notification.Data.ID
+	}
+
+	if provider.WebhookSecret != "" && !provider.validSignature(request, paymentID) {
+		return "", errors.New("invalid webhook signature")
+	}
+
+	return paymentID, nil
+}
+
+// x-signature is "ts=<timestamp>,v1=<hmac>" signing "id:<data.id>;request-id:<x-request-id>;ts:<timestamp>;"
+func (provider *MercadoPagoProvider) validSignature(request *http.Request, paymentID string) bool {
+	var timestamp, signature string
+	for _, part := range strings.Split(request.Header.Get("x-signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "ts":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	expected := signWebhook(provider.WebhookSecret, paymentID, request.Header.Get("x-request-id"), timestamp)
+	return signature != "" && hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func signWebhook(secret string, paymentID string, requestID string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "id:%s;request-id:%s;ts:%s;", strings.ToLower(paymentID), requestID, timestamp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (provider *MercadoPagoProvider) Status(paymentID string) (PaymentStatus, error) {
+	var payment struct {
+		ID                json.Number `json:"id"`
+		Status            string      `json:"status"`
+		ExternalReference string      `json:"external_reference"`
+		TransactionAmount float64     `json:"transaction_amount"`
+	}
+
+	if err := provider.request(http.MethodGet, "/v1/payments/"+paymentID, nil, &payment); err != nil {
+		return PaymentStatus{}, err
+	}
+
+	orderID, err := strconv.Atoi(payment.ExternalReference)
+	if err != nil {
+		return PaymentStatus{}, fmt.Errorf("payment %s without order reference", paymentID)
+	}
+
+	return PaymentStatus{
+		ID:      payment.ID.String(),
+		Status:  payment.Status,
+		OrderID: orderID,
+		Amount:  Money(math.Round(payment.TransactionAmount * 100)),
+	}, nil
+}
+
+// creates the charge of an order paid online and sends the link to the customer
+func RequestOnlinePayment(orderID int, phoneNumber string, order OrdemDeCompra) error {
+	if Vault.Payments == nil {
+		return errors.New("payment gateway not configured")
+	}
+
+	link, err := Vault.Payments.CreateCharge(Charge{
+		OrderID:     orderID,
+		Description: fmt.Sprintf("Pedido #%d", orderID),
+		Amount:      order.Total(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = Vault.PGX.Exec(
+		context.Background(),
+		"INSERT INTO payments (order_id, provider_id, status, amount, link) VALUES ($1, $2, $3, $4, $5)",
+		orderID,
+		link.ID,
+		PaymentPending,
+		int64(order.Total()),
+		link.URL,
+	)
+	failOnError(err, "Can't save payment")
+
+	SendMessageToNumber(phoneNumber, RenderMessage("link_pagamento", MessageData{OrderID: orderID, Order: order, Link: link.URL}))
+	return nil
+}
+
+// charges replaced by a new one keep their link, a payment on them is still confirmed against the order total
+func CancelPendingCharges(orderID int) {
+	_, err := Vault.PGX.Exec(
+		context.Background(),
+		"UPDATE payments SET status = $2, updated = now() WHERE order_id = $1 AND status = $3",
+		orderID,
+		PaymentCancelled,
+		PaymentPending,
+	)
+	failOnError(err, "Can't cancel pending charges")
+}
+
+// links the payment to a charge of the order, the one already holding it or else the unpaid charge of the same
+// amount, newest first. Returns false when the payment was already approved, a repeated notification
+func recordPayment(payment PaymentStatus) bool {
+	result, err := Vault.PGX.Exec(
+		context.Background(),
+		`UPDATE payments SET payment_id = $2, status = $3, updated = now()
+		WHERE provider_id = (
+			SELECT provider_id FROM payments
+			WHERE order_id = $1 AND (payment_id = $2 OR status <> $5)
+			ORDER BY payment_id IS NOT DISTINCT FROM $2 DESC, amount = $4 DESC, created DESC
+			LIMIT 1
+		) AND status <> $5`,
+		payment.OrderID,
+		payment.ID,
+		payment.Status,
+		int64(payment.Amount),
+		PaymentApproved,
+	)
+	failOnError(err, "Can't update payment")
+
+	return result.RowsAffected() > 0
+}
+
+// handles a webhook notification, the status is always confirmed with the provider
+func ConfirmPayment(paymentID string) error {
+	payment, err := Vault.Payments.Status(paymentID)
+	if err != nil {
+		return err
+	}
+
+	if payment.Status != PaymentApproved {
+		recordPayment(payment)
+		return nil
+	}
+
+	var phoneNumber, status string
+	var paidBefore bool
+	var data []byte
+	err = Vault.PGX.QueryRow(context.Background(), "SELECT phone_number, status, paid, data FROM orders WHERE id = $1", payment.OrderID).Scan(&phoneNumber, &status, &paidBefore, &data)
+	if err != nil {
+		return fmt.Errorf("order %d of payment %s not found", payment.OrderID, paymentID)
+	}
+
+	var order OrdemDeCompra
+	err = json.Unmarshal(data, &order)
+	failOnError(err, "Can't parse order")
+
+	refund := status == OrderCancelled || status == OrderRejected || paidBefore
+
+	// left unrecorded so a payment of the full total on another link still confirms the order
+	if !refund && payment.Amount < order.Total() {
+		return fmt.Errorf("payment %s of %s is lower than the order %d total %s", paymentID, payment.Amount, payment.OrderID, order.Total())
+	}
+
+	// repeated notifications of the same payment find it already approved, a new payment without a charge
+	// left to link is a link paid twice
+	if !recordPayment(payment) {
+		var repeated bool
+		err = Vault.PGX.QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM payments WHERE payment_id = $1)", payment.ID).Scan(&repeated)
+		failOnError(err, "Can't check payment")
+		if repeated {
+			return nil
+		}
+		refund = true
+	}
+
+	paid := MessageData{OrderID: payment.OrderID, Customer: order.NomeCompleto, Phone: phoneNumber, Order: order, Status: status, Amount: payment.Amount}
+
+	// the store keeps the money of a cancelled order or of a second link paid, so the staff refunds it
+	if refund {
+		NotifyStaff(Notification{
+			Event:    EventPayment,
+			Message:  RenderMessage("pagamento_estorno", paid),
+			OrderID:  payment.OrderID,
+			Customer: order.NomeCompleto,
+			Phone:    phoneNumber,
+		})
+		return nil
+	}
+
+	// an old charge paid after the total dropped
+	if payment.Amount > order.Total() {
+		NotifyStaff(Notification{
+			Event:    EventPayment,
+			Message:  RenderMessage("pagamento_excedente", paid),
+			OrderID:  payment.OrderID,
+			Customer: order.NomeCompleto,
+			Phone:    phoneNumber,
+		})
+	}
+
+	_, err = Vault.PGX.Exec(context.Background(), "UPDATE orders SET paid = true, updated = now() WHERE id = $1", payment.OrderID)
+	failOnError(err, "Can't mark order as paid")
+
+	// orders the store already moved forward keep their status
+	if status == OrderReceived {
+		_, err = TransitionOrderStatus(payment.OrderID, OrderReceived, OrderPaid)
+		failOnError(err, "Can't set order as paid")
+	}
+
+	SendMessageToNumber(phoneNumber, RenderMessage("pagamento_confirmado", paid))
+	NotifyStaff(Notification{
+		Event:    EventPayment,
+		Message:  RenderMessage("pagamento_recebido", paid),
+		OrderID:  payment.OrderID,
+		Customer: order.NomeCompleto,
+		Phone:    phoneNumber,
+	})
+
+	return nil
+}
+
+func paymentWebhookHandler(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		http.Error(writer, "can't read body", http.StatusBadRequest)
+		return
+	}
+
+	paymentID, err := Vault.Payments.ParseWebhook(request, body)
+	if err != nil {
+		fmt.Printf("Warning: invalid payment webhook: %s\n", err)
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if paymentID != "" {
+		if err := ConfirmPayment(paymentID); err != nil {
+			fmt.Printf("Warning: can't confirm payment %s: %s\n", paymentID, err)
+			NotifyError(fmt.Sprintf("Erro ao confirmar o pagamento %s: %s", paymentID, err), "")
+		}
+	}
+
+	writer.WriteHeader(http.StatusOK)
+}
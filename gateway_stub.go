@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// local server with the parts of the mercado pago api used by MercadoPagoProvider, for testing without a real account.
+// opening the payment link approves the payment and sends the webhook to the notification url
+type paymentStub struct {
+	mu          sync.Mutex
+	baseURL     string
+	secret      string
+	preferences map[string]stubPreference
+	payments    map[string]stubPayment
+	sequence    int
+}
+
+type stubPreference struct {
+	Reference       string
+	Amount          float64
+	NotificationURL string
+}
+
+type stubPayment struct {
+	ID                int     `json:"id"`
+	Status            string  `json:"status"`
+	ExternalReference string  `json:"external_reference"`
+	TransactionAmount float64 `json:"transaction_amount"`
+}
+
+// starts the stub in the background and returns its base url
+func StartPaymentStub(addr string, secret string) string {
+	if addr == "" {
+		addr = "127.0.0.1:8090"
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	failOnError(err, "Can't start payment stub")
+
+	stub := &paymentStub{
+		baseURL:     "http://" + listener.Addr().String(),
+		secret:      secret,
+		preferences: map[string]stubPreference{},
+		payments:    map[string]stubPayment{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/checkout/preferences", stub.createPreference)
+	mux.HandleFunc("/pay/", stub.pay)
+	mux.HandleFunc("/v1/payments/", stub.payment)
+
+	go func() {
+		err := http.Serve(listener, mux)
+		failOnError(err, "Payment stub stopped")
+	}()
+
+	fmt.Printf("Payment stub listening on %s\n", stub.baseURL)
+	return stub.baseURL
+}
+
+func (stub *paymentStub) createPreference(writer http.ResponseWriter, request *http.Request) {
+	var preference struct {
+		Items []struct {
+			Quantity  int     `json:"quantity"`
+			UnitPrice float64 `json:"unit_price"`
+		} `json:"items"`
+		ExternalReference string `json:"external_reference"`
+		NotificationURL   string `json:"notification_url"`
+	}
+
+	if err := json.NewDecoder(request.Body).Decode(&preference); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	amount := 0.0
+	for _, item := range preference.Items {
+		amount += float64(item.Quantity) * item.UnitPrice
+	}
+
+	stub.mu.Lock()
+	stub.sequence++
+	id := fmt.Sprintf("stub-%d", stub.sequence)
+	stub.preferences[id] = stubPreference{
+		Reference:       preference.ExternalReference,
+		Amount:          amount,
+		NotificationURL: preference.NotificationURL,
+	}
+	stub.mu.Unlock()
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]string{
+		"id":         id,
+		"init_point": fmt.Sprintf("%s/pay/%s", stub.baseURL, id),
+	})
+}
+
+func (stub *paymentStub) pay(writer http.ResponseWriter, request *http.Request) {
+	preferenceID := strings.TrimPrefix(request.URL.Path, "/pay/")
+
+	stub.mu.Lock()
+	preference, found := stub.preferences[preferenceID]
+	stub.sequence++
+	payment := stubPayment{
+		ID:                stub.sequence,
+		Status:            PaymentApproved,
+		ExternalReference: preference.Reference,
+		TransactionAmount: preference.Amount,
+	}
+	if found {
+		stub.payments[strconv.Itoa(payment.ID)] = payment
+	}
+	stub.mu.Unlock()
+
+	if !found {
+		http.NotFound(writer, request)
+		return
+	}
+
+	go stub.notify(preference.NotificationURL, strconv.Itoa(payment.ID))
+	fmt.Fprintf(writer, "Pagamento %d aprovado (stub)\n", payment.ID)
+}
+
+func (stub *paymentStub) payment(writer http.ResponseWriter, request *http.Request) {
+	stub.mu.Lock()
+	payment, found := stub.payments[strings.TrimPrefix(request.URL.Path, "/v1/payments/")]
+	stub.mu.Unlock()
+
+	if !found {
+		http.NotFound(writer, request)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(payment)
+}
+
+func (stub *paymentStub) notify(notificationURL string, paymentID string) {
+	body, _ := json.Marshal(map[string]any{
+		"type":   "payment",
+		"action": "payment.updated",
+		"data":   map[string]string{"id": paymentID},
+	})
+
+	request, err := http.NewRequest(http.MethodPost, notificationURL+"?type=payment&data.id="+paymentID, bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("Payment stub: invalid notification url: %s\n", err)
+		return
+	}
+
+	requestID := fmt.Sprintf("stub-request-%s", paymentID)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("x-request-id", requestID)
+	request.Header.Set("x-signature", fmt.Sprintf("ts=%s,v1=%s", timestamp, signWebhook(stub.secret, paymentID, requestID, timestamp)))
+
+	res, err := http.DefaultClient.Do(request)
+	if err != nil {
+		fmt.Printf("Payment stub: webhook failed: %s\n", err)
+		return
+	}
+	res.Body.Close()
+
+	fmt.Printf("Payment stub: webhook for payment %s returned %d\n", paymentID, res.StatusCode)
+}
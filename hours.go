@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+const openingSearchDays = 14
+
+// weekly keys are dom, seg, ter, qua, qui, sex and sab with "08:00-18:00" intervals, no weekly hours means always open
+type BusinessHoursConfig struct {
+	Timezone              string              `json:"timezone"`
+	Weekly                map[string][]string `json:"weekly"`
+	Holidays              []string            `json:"holidays"`
+	AcceptScheduledOrders bool                `json:"accept_scheduled_orders"`
+}
+
+var weekdayKeys = []string{"dom", "seg", "ter", "qua", "qui", "sex", "sab"}
+
+var weekdayNames = []string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"}
+
+// since midnight, intervals crossing midnight like 18:00-02:00 end after 24h
+type openInterval struct {
+	start time.Duration
+	end   time.Duration
+}
+
+const dayLength = 24 * time.Hour
+
+func parseInterval(text string) (openInterval, error) {
+	start, end, found := strings.Cut(text, "-")
+	if !found {
+		return openInterval{}, fmt.Errorf("invalid interval %s, use 08:00-18:00", text)
+	}
+
+	parse := func(clock string) (time.Duration, error) {
+		parsed, err := time.Parse("15:04", strings.TrimSpace(clock))
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %s in %s", clock, text)
+		}
+
+		return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+	}
+
+	interval := openInterval{}
+	var err error
+	if interval.start, err = parse(start); err != nil {
+		return openInterval{}, err
+	}
+
+	if interval.end, err = parse(end); err != nil {
+		return openInterval{}, err
+	}
+
+	if interval.end == interval.start {
+		return openInterval{}, fmt.Errorf("interval %s must end after it starts", text)
+	}
+
+	if interval.end < interval.start {
+		interval.end += dayLength
+	}
+
+	return interval, nil
+}
+
+func (hours BusinessHoursConfig) Validate() error {
+	if _, err := time.LoadLocation(hours.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %s: %w", hours.Timezone, err)
+	}
+
+	for day, intervals := range hours.Weekly {
+		if !slices.Contains(weekdayKeys, day) {
+			return fmt.Errorf("invalid weekday %s, use %s", day, strings.Join(weekdayKeys, ", "))
+		}
+
+		for _, interval := range intervals {
+			if _, err := parseInterval(interval); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, holiday := range hours.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday); err != nil {
+			return fmt.Errorf("invalid holiday %s, use YYYY-MM-DD", holiday)
+		}
+	}
+
+	return nil
+}
+
+func (hours BusinessHoursConfig) Enabled() bool {
+	return len(hours.Weekly) > 0
+}
+
+// intervals of the day as configured, holidays have none
+func (hours BusinessHoursConfig) weeklyIntervals(date time.Time) []openInterval {
+	if slices.Contains(hours.Holidays, date.Format("2006-01-02")) {
+		return nil
+	}
+
+	intervals := []openInterval{}
+	for _, text := range hours.Weekly[weekdayKeys[date.Weekday()]] {
+		interval, _ := parseInterval(text)
+		intervals = append(intervals, interval)
+	}
+
+	return intervals
+}
+
+// intervals crossing midnight are split, the part after midnight opens the next day
+func (hours BusinessHoursConfig) intervals(date time.Time) []openInterval {
+	intervals := []openInterval{}
+	for _, interval := range hours.weeklyIntervals(date.AddDate(0, 0, -1)) {
+		if interval.end > dayLength {
+			intervals = append(intervals, openInterval{start: 0, end: interval.end - dayLength})
+		}
+	}
+
+	for _, interval := range hours.weeklyIntervals(date) {
+		interval.end = min(interval.end, dayLength)
+		intervals = append(intervals, interval)
+	}
+
+	return intervals
+}
+
+func midnight(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+}
+
+func (hours BusinessHoursConfig) IsOpen(now time.Time) bool {
+	if !hours.Enabled() {
+		return true
+	}
+
+	sinceMidnight := now.Sub(midnight(now))
+	return slices.ContainsFunc(hours.intervals(now), func(interval openInterval) bool {
+		return sinceMidnight >= interval.start && sinceMidnight < interval.end
+	})
+}
+
+// start of the next open interval after now, zero when there is none in the next days
+func (hours BusinessHoursConfig) NextOpening(now time.Time) time.Time {
+	for offset := range openingSearchDays {
+		day := midnight(now).AddDate(0, 0, offset)
+		for _, interval := range hours.intervals(day) {
+			if opening := day.Add(interval.start); opening.After(now) {
+				return opening
+			}
+		}
+	}
+
+	return time.Time{}
+}
+
+// open or closed status given to the model every turn
+func (hours BusinessHoursConfig) Status(now time.Time) string {
+	if hours.IsOpen(now) {
+		return "A loja está aberta agora."
+	}
+
+	status := "A loja está fechada agora."
+	if opening := hours.NextOpening(now); !opening.IsZero() {
+		status = fmt.Sprintf("%s Próxima abertura: %s, %s às %s.", status, weekdayNames[opening.Weekday()], opening.Format("02/01"), opening.Format("15:04"))
+	}
+
+	if hours.AcceptScheduledOrders {
+		return status + " Informe isso ao usuário. Pedidos podem ser feitos normalmente e serão preparados a partir da próxima abertura."
+	}
+
+	return status + " Informe isso ao usuário e não finalize pedidos até a loja abrir."
+}
+
+// system message with the date and store status of this turn
+func SystemPrompt(now time.Time) string {
+	prompt := strings.ReplaceAll(Vault.SystemMessage, "#today", now.Format("02/01/2006"))
+	if !Vault.Config.BusinessHours.Enabled() {
+		return prompt
+	}
+
+	return fmt.Sprintf("%s\n\nHorário atual: %s. %s", prompt, now.Format("15:04"), Vault.Config.BusinessHours.Status(now))
+}
+
+func checkBusinessHoursRule(checkout *Checkout) []string {
+	hours := Vault.Config.BusinessHours
+	now := time.Now()
+	if hours.IsOpen(now) {
+		return nil
+	}
+
+	if !hours.AcceptScheduledOrders {
+		return []string{"a loja está fechada e não aceita pedidos agora, informe o horário de funcionamento ao usuário"}
+	}
+
+	// with delivery slots the order waits for a slot with capacity instead of the next opening
+	if Vault.Config.DeliverySlots.Enabled() && checkout.Chat.DeliverySlot == nil {
+		return []string{"a loja está fechada, chame agendar_entrega e combine com o usuário um horário de entrega"}
+	}
+
+	if checkout.Order.AgendadoPara == nil {
+		opening := hours.NextOpening(now)
+		if opening.IsZero() {
+			return []string{"a loja está fechada e não há próxima abertura definida"}
+		}
+		checkout.Order.AgendadoPara = &opening
+	}
+
+	return nil
+}
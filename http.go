@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func StartHTTPServer(addr string) {
+	mux := http.NewServeMux()
+	if Vault.Payments != nil {
+		mux.HandleFunc("/webhooks/pagamento", lockedHandler(paymentWebhookHandler))
+	}
+
+	if Vault.Config.DeliverySlots.CalendarToken != "" {
+		mux.HandleFunc("GET /agenda.ics", lockedHandler(calendarFeedHandler))
+		mux.HandleFunc("GET /agenda/{day}", lockedHandler(calendarDayHandler))
+	}
+
+	fmt.Printf("HTTP server listening on %s\n", addr)
+	err := http.ListenAndServe(addr, mux)
+	failOnError(err, "HTTP server stopped")
+}
+
+// handlers share the database connection with the message consumer
+func lockedHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		Vault.Lock.Lock()
+		defer Vault.Lock.Unlock()
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				fmt.Printf("Failed to handle %s: %v\n", request.URL.Path, recovered)
+				NotifyError(fmt.Sprintf("Erro ao processar %s: %v", request.URL.Path, recovered), "")
+				http.Error(writer, "internal error", http.StatusInternalServerError)
+			}
+		}()
+
+		handler(writer, request)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const maxButtonOptions = 3
+
+type InteractiveOption struct {
+	ID        string `json:"id"`
+	Titulo    string `json:"titulo"`
+	Descricao string `json:"descricao"`
+}
+
+type InteractiveChoice struct {
+	Titulo    string              `json:"titulo"`
+	Descricao string              `json:"descricao"`
+	Opcoes    []InteractiveOption `json:"opcoes"`
+}
+
+func sendOptionsTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "enviar_opcoes",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Envia ao usuário uma lista de opções para ele escolher, por exemplo as formas de pagamento ou os sabores de um produto. Após chamar, aguarde a escolha do usuário sem repetir as opções no texto."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"titulo",
+					"descricao",
+					"opcoes",
+				},
+				"properties": map[string]interface{}{
+					"titulo": map[string]string{
+						"type":        "string",
+						"description": "Título curto da pergunta",
+					},
+					"descricao": map[string]string{
+						"type":        "string",
+						"description": "Texto explicando o que o usuário deve escolher",
+					},
+					"opcoes": map[string]interface{}{
+						"type":        "array",
+						"description": "Opções disponíveis, no máximo 10",
+						"items": map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"id": map[string]string{
+									"type":        "string",
+									"description": "Identificador da opção, ex. pix ou id_produto",
+								},
+								"titulo": map[string]string{
+									"type":        "string",
+									"description": "Texto da opção, com até 24 caracteres",
+								},
+								"descricao": map[string]string{
+									"type":        "string",
+									"description": "Detalhe da opção, pode ser vazio",
+								},
+							},
+							"additionalProperties": false,
+							"required": []string{
+								"id",
+								"titulo",
+								"descricao",
+							},
+						},
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) SendOptions(choice InteractiveChoice) string {
+	if len(choice.Opcoes) == 0 {
+		return "nenhuma opção informada"
+	}
+
+	chat.PendingOptions = choice.Opcoes
+
+	if Vault.EnableInteractive {
+		var status int
+		if len(choice.Opcoes) <= maxButtonOptions {
+			status = chat.sendButtons(choice)
+		} else {
+			status = chat.sendList(choice)
+		}
+
+		if status >= 200 && status < 300 {
+			return "opções enviadas ao usuário, aguardando a escolha"
+		}
+
+		fmt.Printf("Warning: interactive message refused with status %d, falling back to text\n", status)
+	}
+
+	chat.SendMessageToWhatsApp(choice.PlainText())
+	return "opções enviadas ao usuário como texto numerado, aguardando a escolha"
+}
+
+func (chat WhatsAppChat) sendButtons(choice InteractiveChoice) int {
+	buttons := []map[string]string{}
+	for _, option := range choice.Opcoes {
+		buttons = append(buttons, map[string]string{
+			"type":        "reply",
+			"displayText": option.Titulo,
+			"id":          option.ID,
+		})
+	}
+
+	status, _, err := EvolutionRequest("message/sendButtons", map[string]any{
+		"number":      chat.Number,
+		"title":       choice.Titulo,
+		"description": choice.Descricao,
+		"footer":      "",
+		"buttons":     buttons,
+	})
+	if err != nil {
+		fmt.Printf("Warning: can't send buttons to %s: %s\n", chat.Number, err)
+	}
+
+	return status
+}
+
+func (chat WhatsAppChat) sendList(choice InteractiveChoice) int {
+	rows := []map[string]string{}
+	for _, option := range choice.Opcoes {
+		rows = append(rows, map[string]string{
+			"title":       option.Titulo,
+			"description": option.Descricao,
+			"rowId":       option.ID,
+		})
+	}
+
+	status, _, err := EvolutionRequest("message/sendList", map[string]any{
+		"number":      chat.Number,
+		"title":       choice.Titulo,
+		"description": choice.Descricao,
+		"buttonText":  "Ver opções",
+		"footerText":  "",
+		"sections": []map[string]any{
+			{
+				"title": choice.Titulo,
+				"rows":  rows,
+			},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: can't send list to %s: %s\n", chat.Number, err)
+	}
+
+	return status
+}
+
+func (choice InteractiveChoice) PlainText() string {
+	lines := []string{fmt.Sprintf("*%s*", choice.Titulo)}
+	if choice.Descricao != "" {
+		lines = append(lines, choice.Descricao)
+	}
+
+	lines = append(lines, "")
+	for i, option := range choice.Opcoes {
+		line := fmt.Sprintf("%d. %s", i+1, option.Titulo)
+		if option.Descricao != "" {
+			line = fmt.Sprintf("%s - %s", line, option.Descricao)
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "", "Responda com o número da opção.")
+	return strings.Join(lines, "\n")
+}
+
+// maps a button/list id or a numbered text reply to one of the pending options, the options are
+// cleared by any reply so a later number isn't taken as an old choice
+func (chat *WhatsAppChat) ResolveOption(reply string) (InteractiveOption, bool) {
+	reply = strings.TrimSpace(reply)
+	options := chat.PendingOptions
+	chat.PendingOptions = nil
+
+	for _, option := range options {
+		if option.ID == reply {
+			return option, true
+		}
+	}
+
+	index, err := strconv.Atoi(strings.TrimSuffix(reply, "."))
+	if err != nil || index < 1 || index > len(options) {
+		return InteractiveOption{}, false
+	}
+
+	return options[index-1], true
+}
+
+func (option InteractiveOption) Describe() string {
+	return fmt.Sprintf("Opção escolhida: %s (id: %s)", option.Titulo, option.ID)
+}
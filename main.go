@@ -10,7 +10,6 @@ import (
 	"os/signal"
 	"regexp"
 	"slices"
-	"strings"
 	"syscall"
 	"time"
 
@@ -25,9 +24,6 @@ func failOnError(err error, msg string) {
 }
 
 func main() {
-	// Set timezone
-	// time.Local, _ = time.LoadLocation("America/Sao_Paulo")
-
 	// Get and validate flags
 	var rabbitMqUri string
 	flag.StringVar(&rabbitMqUri, "amqp", "-1", "the rabbitmq connection uri")
@@ -48,7 +44,7 @@ func main() {
 	flag.StringVar(&evoUrl, "evourl", "-1", "evolution api url")
 
 	var calendarEmail string
-	flag.StringVar(&calendarEmail, "email", "-1", "google calendar email")
+	flag.StringVar(&calendarEmail, "email", "", "organizer email of the scheduled deliveries calendar")
 
 	var cronParams string
 	flag.StringVar(&cronParams, "cron", "*/5 * * * *", "event list harvest cron")
@@ -62,6 +58,18 @@ func main() {
 	var forMe bool
 	flag.BoolVar(&forMe, "me", false, "enable conversation in same number as instance")
 
+	var typingDelay int
+	flag.IntVar(&typingDelay, "typingdelay", 0, "simulated typing milliseconds per reply character, 0 disables")
+
+	var configFile string
+	flag.StringVar(&configFile, "config", "./config.json", "store configuration file")
+
+	var httpAddr string
+	flag.StringVar(&httpAddr, "http", "", "address of the http server for webhooks, ex. :8080, empty disables")
+
+	var interactive bool
+	flag.BoolVar(&interactive, "interactive", false, "send choices as whatsapp buttons and lists instead of plain text")
+
 	flag.Parse()
 
 	// assert flags
@@ -74,9 +82,19 @@ func main() {
 	assertFlag(evoUrl, "http.*", "evourl")
 	assertFlag(pg, `(postgres(?:ql)?):\/\/(?:([^@\s]+)@)?([^\/\s]+)(?:\/(\w+))?(?:\?(.+))?`, "pg")
 
-	// Catalog
-	catalog, err := os.ReadFile("./Catalogo.pdf")
-	failOnError(err, "Can't open catalog")
+	// Store config and products
+	config := LoadStoreConfig(configFile)
+
+	location, err := time.LoadLocation(config.BusinessHours.Timezone)
+	failOnError(err, "Can't load timezone")
+	time.Local = location
+
+	products := LoadProductCatalog(config.ProductsFile)
+	documents := LoadDocumentStore(config.DocumentsDir, config.CatalogFile)
+	go documents.Watch(documentsReloadInterval)
+
+	messages := LoadMessageTemplates(config.MessagesDir)
+	go messages.Watch(messageTemplatesReloadInterval)
 
 	// Initialize Vault Singleton
 	Vault.OpenAIApiKey = openAIToken
@@ -87,7 +105,15 @@ func main() {
 	Vault.Conversations = map[string]*WhatsAppChat{}
 	Vault.OwnerNumber = ownerNumber
 	Vault.EnableForMe = forMe
-	Vault.CatalogAttachment = catalog
+	Vault.TypingDelayPerChar = time.Duration(typingDelay) * time.Millisecond
+	Vault.EnableInteractive = interactive
+	Vault.Config = config
+	Vault.Products = products
+	Vault.Documents = documents
+	Vault.Payments = NewPaymentProvider(config.PaymentGateway)
+	Vault.CalendarEmail = calendarEmail
+	Vault.Messages = messages
+	Vault.CEPLookup = LoadLocalCEPLookup(config.CEPFile)
 
 	// Initilize scheduler
 	// fmt.Println("Initializing scheduler")
@@ -107,7 +133,7 @@ func main() {
 	fmt.Println("Loading default system message")
 	systemMessage, err := os.ReadFile("./system-message.txt")
 	failOnError(err, "Failed to open openai system message")
-	Vault.SystemMessage = strings.ReplaceAll(string(systemMessage), "#today", time.Now().Format("02/01/2006"))
+	Vault.SystemMessage = string(systemMessage)
 
 	// Initialize database
 	fmt.Println("Connecting to database")
@@ -131,6 +157,13 @@ func main() {
 	// Listen to RabbitMQ events
 	// TODO listen for system maintence messages
 	go listenMessagesUpsert(ch, exchangeName)
+	go StartScheduler()
+
+	if httpAddr != "" {
+		go StartHTTPServer(httpAddr)
+	} else if Vault.Payments != nil {
+		fmt.Println("Warning: payment gateway enabled without -http, payment webhooks will not be received")
+	}
 
 	fmt.Println("Application started. To exit press CTRL+C")
 	sig := <-sigs
@@ -170,50 +203,172 @@ func listenMessagesUpsert(ch *amqp.Channel, exchangeName string) {
 	failOnError(err, "Failed to listen to messages upsert")
 
 	for msg := range msgs {
-		var conversation map[string]interface{}
-		err = json.Unmarshal(msg.Body, &conversation)
+		var upsert EvolutionUpsert
+		err = json.Unmarshal(msg.Body, &upsert)
 		failOnError(err, "Can't unmarshal conversation")
 
-		// TODO HOLY SHIT! make an struct for this \/!!!
-		remoteJID := conversation["data"].(map[string]interface{})["key"].(map[string]interface{})["remoteJid"].(string)
-		fromMe := conversation["data"].(map[string]interface{})["key"].(map[string]interface{})["fromMe"].(bool)
-
 		// Skip self messages
-		if fromMe && !Vault.EnableForMe {
+		if upsert.Data.Key.FromMe && !Vault.EnableForMe {
 			fmt.Println("Skipping self message")
 			continue
 		}
 
 		// extract phone number
-		reg, _ := regexp.Compile(`^(\d+)@.+`)
-		match := reg.FindSubmatch([]byte(remoteJID))
+		phoneNumber := upsert.Data.PhoneNumber()
+		if phoneNumber == "" {
+			fmt.Println("Warning: Can't extract the phone number from package")
+			continue
+		}
 
-		if match != nil {
-			chat := GetOrCreateConversation(string(match[1]))
+		handleUpsert(phoneNumber, upsert.Data)
+	}
+}
 
-			messageType := conversation["data"].(map[string]interface{})["messageType"].(string)
-			if messageType == "conversation" {
-				remoteMessage := conversation["data"].(map[string]interface{})["message"].(map[string]interface{})["conversation"].(string)
-				fmt.Printf("Received message from %s: %s\n", chat.Number, remoteMessage)
-				chat.SendToOpenAI(remoteMessage, "user", nil)
+// a failure handling one message is reported to the staff instead of stopping the consumer
+func handleUpsert(phoneNumber string, data EvolutionUpsertData) {
+	Vault.Lock.Lock()
+	defer Vault.Lock.Unlock()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			fmt.Printf("Failed to handle message from %s: %v\n", phoneNumber, recovered)
+			NotifyError(fmt.Sprintf("Erro ao processar a mensagem de %s: %v", phoneNumber, recovered), phoneNumber)
+			if phoneNumber != Vault.OwnerNumber {
+				ApologizeForError(phoneNumber)
 			}
+		}
+	}()
 
-			if messageType == "imageMessage" || messageType == "documentMessage" {
-				key := conversation["data"].(map[string]interface{})["key"].(map[string]interface{})["id"].(string)
-				media := GetMediaBase64(key)
+	if IsOwnerCommand(phoneNumber, data.Message.CommandText()) {
+		HandleOwnerCommand(data.Message.CommandText())
+		return
+	}
 
-				if !slices.Contains([]string{"application/pdf", "image/jpeg", "image/jpg"}, media.MimeType) {
-					fmt.Printf("Invalid file mime type %s", media.MimeType)
-					chat.SendToOpenAI("O usuário enviou o comprovante porém não reconheci o formato.", "developer", nil)
-					continue
+	chat := GetOrCreateConversation(phoneNumber)
+	handleUpsertMessage(chat, data)
+}
+
+func handleUpsertMessage(chat *WhatsAppChat, data EvolutionUpsertData) {
+	incoming := WhatsAppChatMessage{
+		Role:      "user",
+		MessageID: data.Key.ID,
+	}
+
+	// keep the context of swipe replies
+	if contextInfo := data.Message.ContextInfo(); contextInfo != nil && contextInfo.StanzaID != "" {
+		incoming.QuotedID = contextInfo.StanzaID
+		if quoted := chat.FindMessageByID(contextInfo.StanzaID); quoted != nil {
+			incoming.QuotedText = quoted.Text
+		} else if contextInfo.QuotedMessage != nil {
+			incoming.QuotedText = contextInfo.QuotedMessage.Text()
+		}
+	}
+
+	switch data.MessageType {
+	case "conversation", "extendedTextMessage":
+		incoming.Text = data.Message.Text()
+		fmt.Printf("Received message from %s: %s\n", chat.Number, incoming.Text)
+
+		// numbered reply to options sent as plain text
+		if option, ok := chat.ResolveOption(incoming.Text); ok {
+			incoming.Text = option.Describe()
+		}
+
+		chat.SendToOpenAI(incoming)
+
+	case "buttonsResponseMessage", "listResponseMessage", "templateButtonReplyMessage":
+		option, ok := chat.ResolveOption(data.Message.SelectedOptionID())
+		if !ok {
+			option = InteractiveOption{ID: data.Message.SelectedOptionID(), Titulo: data.Message.Text()}
+		}
+
+		incoming.Text = option.Describe()
+		fmt.Printf("Received option from %s: %s\n", chat.Number, incoming.Text)
+		chat.SendToOpenAI(incoming)
+
+	case "imageMessage", "documentMessage":
+		media := GetMediaBase64(data.Key.ID)
+		caption := data.Message.Text()
+
+		if !chat.AwaitingPayment() {
+			if data.MessageType == "imageMessage" && slices.Contains([]string{"image/jpeg", "image/jpg"}, media.MimeType) {
+				incoming.Text = caption
+				if incoming.Text == "" {
+					incoming.Text = "imagem enviada pelo usuário"
 				}
 
-				chat.SendToOpenAI("comprovante de pagamento", "user", &media)
-				chat.AllowSendReceipt = false
+				incoming.FileBase64 = media.Base64
+				incoming.FileMimetype = media.MimeType
+				chat.SendToOpenAI(incoming)
+				return
 			}
-		} else {
-			fmt.Println("Warning: Can't extract the phone number from package")
+
+			incoming.Text = fmt.Sprintf("O usuário enviou um arquivo do tipo %s", media.MimeType)
+			if media.FileName != "" {
+				incoming.Text = fmt.Sprintf("O usuário enviou o arquivo %s", media.FileName)
+			}
+
+			if caption != "" {
+				incoming.Text = fmt.Sprintf("%s com a legenda: %s", incoming.Text, caption)
+			}
+
+			chat.SendToOpenAI(incoming)
+			return
+		}
+
+		if !slices.Contains([]string{"application/pdf", "image/jpeg", "image/jpg"}, media.MimeType) {
+			fmt.Printf("Invalid file mime type %s", media.MimeType)
+			chat.SendToOpenAI(WhatsAppChatMessage{
+				Role: "developer",
+				Text: "O usuário enviou o comprovante porém não reconheci o formato.",
+			})
+			return
+		}
+
+		incoming.Text = "comprovante de pagamento"
+		if caption != "" {
+			incoming.Text = fmt.Sprintf("%s: %s", incoming.Text, caption)
 		}
+
+		incoming.FileBase64 = media.Base64
+		incoming.FileMimetype = media.MimeType
+		// cleared before the turn so the suspended chat stores it
+		chat.Receipt = media
+		chat.AwaitingReceipt = false
+		chat.SendToOpenAI(incoming)
+
+	case "locationMessage":
+		if data.Message.LocationMessage == nil {
+			fmt.Printf("Skipping location message without location from %s\n", chat.Number)
+			return
+		}
+
+		location := *data.Message.LocationMessage
+		chat.SharedLocation = &location
+		chat.Messages = append(chat.Messages, WhatsAppChatMessage{
+			Role: "developer",
+			Text: "O usuário compartilhou a localização abaixo. Use-a como candidato para o campo endereco e confirme com o usuário o endereço completo, número e complemento antes de finalizar o pedido.",
+		})
+
+		incoming.Text = fmt.Sprintf("Localização compartilhada: %s", location.Describe())
+		chat.SendToOpenAI(incoming)
+
+	case "contactMessage":
+		if data.Message.ContactMessage == nil {
+			fmt.Printf("Skipping contact message without contact from %s\n", chat.Number)
+			return
+		}
+
+		contact := ParseVCard(data.Message.ContactMessage.Vcard)
+		if contact.Name == "" {
+			contact.Name = data.Message.ContactMessage.DisplayName
+		}
+
+		incoming.Text = fmt.Sprintf("Contato compartilhado: %s", contact.Describe())
+		chat.SendToOpenAI(incoming)
+
+	default:
+		fmt.Printf("Skipping unsupported message type %s\n", data.MessageType)
 	}
 }
 
@@ -226,7 +381,6 @@ func GetOrCreateConversation(phoneNumber string) *WhatsAppChat {
 		Number:              phoneNumber,
 		Messages:            []WhatsAppChatMessage{},
 		LastInteractionTime: time.Now(),
-		AllowSendReceipt:    false,
 	}
 
 	var suspendedData string
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	messageTemplateExt             = ".tmpl"
+	messageTemplatesReloadInterval = 10 * time.Second
+)
+
+// default messages, a file with the same name in the messages dir replaces the default
+//
+//go:embed templates/*.tmpl
+var defaultMessageTemplates embed.FS
+
+// fields available to the message templates, each template uses the ones it needs
+type MessageData struct {
+	OrderID       int
+	Customer      string
+	Phone         string
+	Order         OrdemDeCompra
+	Status        string
+	Reason        string
+	Changes       []string
+	PreviousTotal string
+	Minutes       int
+	Link          string
+	Amount        Money
+}
+
+type MessageTemplates struct {
+	mu        sync.RWMutex
+	dir       string
+	templates *template.Template
+	signature string
+}
+
+var messageFuncs = template.FuncMap{
+	"dinheiro":  func(value Money) string { return value.String() },
+	"data":      func(date time.Time) string { return date.Format("02/01/2006") },
+	"datahora":  func(date time.Time) string { return date.Format("02/01/2006 15:04") },
+	"produtos":  formatProductLines,
+	"status":    OrderStatusLabel,
+	"pagamento": PaymentLabel,
+	"link":      func(phone string) string { return fmt.Sprintf("https://wa.me/%s", phone) },
+	"join":      strings.Join,
+}
+
+func LoadMessageTemplates(dir string) *MessageTemplates {
+	messages := &MessageTemplates{dir: dir}
+
+	err := messages.Reload()
+	failOnError(err, "Can't load message templates")
+
+	return messages
+}
+
+// reloads the templates when any file in the directory changes, invalid templates keep the previous version
+func (messages *MessageTemplates) Watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if !messages.changed() {
+			continue
+		}
+
+		if err := messages.Reload(); err != nil {
+			fmt.Printf("Warning: can't reload message templates: %s\n", err)
+			continue
+		}
+
+		fmt.Println("Message templates reloaded")
+	}
+}
+
+func (messages *MessageTemplates) changed() bool {
+	signature := dirSignature(messages.dir)
+
+	messages.mu.RLock()
+	defer messages.mu.RUnlock()
+	return signature != messages.signature
+}
+
+func (messages *MessageTemplates) Reload() error {
+	signature := dirSignature(messages.dir)
+
+	templates, err := messages.parse()
+	if err != nil {
+		return err
+	}
+
+	messages.mu.Lock()
+	defer messages.mu.Unlock()
+	messages.templates = templates
+	messages.signature = signature
+
+	return nil
+}
+
+func (messages *MessageTemplates) parse() (*template.Template, error) {
+	sources := map[string]string{}
+
+	defaults, err := defaultMessageTemplates.ReadDir("templates")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range defaults {
+		content, err := defaultMessageTemplates.ReadFile("templates/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		sources[strings.TrimSuffix(entry.Name(), messageTemplateExt)] = string(content)
+	}
+
+	entries, err := os.ReadDir(messages.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != messageTemplateExt {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), messageTemplateExt)
+		if _, known := sources[name]; !known {
+			return nil, fmt.Errorf("unknown message template %s", entry.Name())
+		}
+
+		content, err := os.ReadFile(filepath.Join(messages.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		sources[name] = string(content)
+	}
+
+	names := []string{}
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	templates := template.New("").Funcs(messageFuncs)
+	for _, name := range names {
+		if _, err := templates.New(name).Parse(sources[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	// renders every template once so a missing field fails here instead of when sending
+	sample := sampleMessageData()
+	for _, name := range names {
+		if err := templates.ExecuteTemplate(io.Discard, name, sample); err != nil {
+			return nil, err
+		}
+	}
+
+	return templates, nil
+}
+
+func (messages *MessageTemplates) Render(name string, data MessageData) string {
+	messages.mu.RLock()
+	defer messages.mu.RUnlock()
+
+	var buffer bytes.Buffer
+	err := messages.templates.ExecuteTemplate(&buffer, name, data)
+	failOnError(err, fmt.Sprintf("Can't render message %s", name))
+
+	return strings.TrimSpace(buffer.String())
+}
+
+func RenderMessage(name string, data MessageData) string {
+	return Vault.Messages.Render(name, data)
+}
+
+func sampleMessageData() MessageData {
+	sampleDate := time.Date(2025, 1, 1, 8, 0, 0, 0, time.Local)
+	return MessageData{
+		OrderID:  1,
+		Customer: "Cliente",
+		Phone:    "5511999999999",
+		Order: OrdemDeCompra{
+			Produtos:         []Produto{{IdProduto: "1", NomeProduto: "Produto", Quantidade: 1, Valor: "R$ 10,00"}},
+			ValorTotal:       "R$ 10,00",
+			NomeCompleto:     "Cliente",
+			Endereco:         "Rua, 1 - Bairro",
+			FormaDePagamento: "pix",
+			Subtotal:         1000,
+			Descontos:        []Desconto{{Promocao: "promocao", Descricao: "Promoção", Valor: 100}},
+			Cupom:            "CUPOM",
+			AgendadoPara:     &sampleDate,
+		},
+		Status:        OrderReceived,
+		Reason:        "motivo",
+		Changes:       []string{"+ 1x Produto R$ 10,00"},
+		PreviousTotal: "R$ 0,00",
+		Minutes:       1,
+		Link:          "https://example.com/pagamento",
+		Amount:        1000,
+	}
+}
+
+// one product per line, used in the staff notifications
+func formatProductLines(products []Produto) string {
+	lines := []string{}
+	for _, product := range products {
+		line := fmt.Sprintf("%d %s", product.Quantidade, product.NomeProduto)
+		if product.Detalhes != "" {
+			line = fmt.Sprintf("%s (%s)", line, product.Detalhes)
+		}
+		lines = append(lines, fmt.Sprintf("%s, %s", line, product.Valor))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// amount in cents
+type Money int64
+
+var thousandsOnly = regexp.MustCompile(`^-?[1-9]\d{0,2}\.\d{3}$`)
+
+func ParseMoney(value string) (Money, error) {
+	clean := strings.TrimSpace(value)
+	clean = strings.TrimPrefix(clean, "R$")
+	clean = strings.ReplaceAll(clean, " ", "")
+	if clean == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	// brazilian format uses dot for thousands and comma for decimals, a single dot followed by
+	// three digits is a thousands separator as in "1.500", otherwise a decimal point as in "12.50"
+	if strings.Contains(clean, ",") {
+		clean = strings.ReplaceAll(clean, ".", "")
+		clean = strings.ReplaceAll(clean, ",", ".")
+	} else if strings.Count(clean, ".") > 1 || thousandsOnly.MatchString(clean) {
+		clean = strings.ReplaceAll(clean, ".", "")
+	}
+
+	amount, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+
+	return Money(math.Round(amount * 100)), nil
+}
+
+func (money Money) String() string {
+	sign := ""
+	cents := int64(money)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	reais := strconv.FormatInt(cents/100, 10)
+	for i := len(reais) - 3; i > 0; i -= 3 {
+		reais = reais[:i] + "." + reais[i:]
+	}
+
+	return fmt.Sprintf("%sR$ %s,%02d", sign, reais, cents%100)
+}
+
+func (money Money) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("%.2f", float64(money)/100)), nil
+}
+
+// accepts numbers in reais (12.5) or strings in any format ParseMoney understands
+func (money *Money) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+
+	if text == "" || text == "null" {
+		*money = 0
+		return nil
+	}
+
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+
+	*money = parsed
+	return nil
+}
+
+func (money Money) Percent(percent float64) Money {
+	return Money(math.Round(float64(money) * percent / 100))
+}
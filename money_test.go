@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"R$ 129,90", 12990},
+		{"129.90", 12990},
+		{"12.5", 1250},
+		{"10", 1000},
+		{"1.500", 150000},
+		{"R$ 1.500", 150000},
+		{"1.500,00", 150000},
+		{"1.500.000", 150000000},
+		{"0.500", 50},
+		{"1500.50", 150050},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			got, err := ParseMoney(test.in)
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) returned %s", test.in, err)
+			}
+			if got != test.want {
+				t.Errorf("ParseMoney(%q) = %d, want %d", test.in, got, test.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "R$", "abc"} {
+		if _, err := ParseMoney(invalid); err == nil {
+			t.Errorf("ParseMoney(%q) should fail", invalid)
+		}
+	}
+}
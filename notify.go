@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"text/template"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	EventNewOrder         = "new_order"
+	EventReceipt          = "receipt"
+	EventPayment          = "payment"
+	EventOrderUpdate      = "order_update"
+	EventCancelRequest    = "cancel_request"
+	EventApproval         = "approval"
+	EventHandoff          = "handoff"
+	EventDeliveryReminder = "delivery_reminder"
+	EventError            = "error"
+)
+
+var notificationEvents = []string{
+	EventNewOrder,
+	EventReceipt,
+	EventPayment,
+	EventOrderUpdate,
+	EventCancelRequest,
+	EventApproval,
+	EventHandoff,
+	EventDeliveryReminder,
+	EventError,
+}
+
+// events without a route go to the owner number
+type NotificationsConfig struct {
+	Targets []NotificationTarget `json:"targets"`
+	Routes  map[string][]string  `json:"routes"`
+}
+
+// number can be a phone number or a group jid, ex. 120363000000000000@g.us
+type NotificationTarget struct {
+	Name     string `json:"name"`
+	Number   string `json:"number"`
+	Role     string `json:"role"`
+	Template string `json:"template"`
+}
+
+type Notification struct {
+	Event    string
+	Message  string
+	OrderID  int
+	Customer string
+	Phone    string
+	Link     string
+	Media    *NotificationMedia
+}
+
+type NotificationMedia struct {
+	Content   []byte
+	MediaType string
+	MimeType  string
+	FileName  string
+}
+
+type HandoffRequest struct {
+	Motivo string `json:"motivo"`
+}
+
+func (config NotificationsConfig) Validate() error {
+	for event, roles := range config.Routes {
+		if !slices.Contains(notificationEvents, event) {
+			return fmt.Errorf("unknown notification event %s", event)
+		}
+
+		for _, role := range roles {
+			if !slices.ContainsFunc(config.Targets, func(target NotificationTarget) bool { return target.Role == role }) {
+				return fmt.Errorf("no notification target with role %s for event %s", role, event)
+			}
+		}
+	}
+
+	for _, target := range config.Targets {
+		if target.Number == "" {
+			return fmt.Errorf("notification target %s without number", target.Name)
+		}
+
+		if _, err := target.parseTemplate(); err != nil {
+			return fmt.Errorf("notification target %s: %w", target.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (config NotificationsConfig) TargetsFor(event string) []NotificationTarget {
+	roles, routed := config.Routes[event]
+	if !routed {
+		return []NotificationTarget{{Name: "dono", Number: Vault.OwnerNumber}}
+	}
+
+	targets := []NotificationTarget{}
+	for _, target := range config.Targets {
+		if slices.Contains(roles, target.Role) {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
+
+func (target NotificationTarget) parseTemplate() (*template.Template, error) {
+	text := target.Template
+	if text == "" {
+		text = "{{.Message}}"
+	}
+
+	return template.New(target.Name).Option("missingkey=error").Parse(text)
+}
+
+func (target NotificationTarget) Render(notification Notification) (string, error) {
+	tmpl, err := target.parseTemplate()
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, notification); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// sends the notification to every target routed for its event
+func NotifyStaff(notification Notification) {
+	if notification.Phone != "" && notification.Link == "" {
+		notification.Link = fmt.Sprintf("https://wa.me/%s", notification.Phone)
+	}
+
+	for _, target := range Vault.Config.Notifications.TargetsFor(notification.Event) {
+		message, err := target.Render(notification)
+		if err != nil {
+			fmt.Printf("Warning: can't render %s notification for %s: %s\n", notification.Event, target.Name, err)
+			message = notification.Message
+		}
+
+		if notification.Media != nil {
+			SendMediaToNumber(
+				target.Number,
+				notification.Media.Content,
+				notification.Media.MediaType,
+				notification.Media.MimeType,
+				notification.Media.FileName,
+				message,
+				false,
+			)
+			continue
+		}
+
+		SendMessageToNumber(target.Number, message)
+	}
+}
+
+// error notifications must never take the consumer down with them
+func NotifyError(reason string, phoneNumber string) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			fmt.Printf("Can't send error notification: %v\n", recovered)
+		}
+	}()
+
+	NotifyStaff(Notification{
+		Event:   EventError,
+		Message: RenderMessage("erro_equipe", MessageData{Reason: reason, Phone: phoneNumber}),
+		Phone:   phoneNumber,
+	})
+}
+
+func ApologizeForError(phoneNumber string) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			fmt.Printf("Can't send error apology: %v\n", recovered)
+		}
+	}()
+
+	SendMessageToNumber(phoneNumber, RenderMessage("erro_desculpas", MessageData{Phone: phoneNumber}))
+}
+
+func handoffTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "chamar_atendente",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Chama um atendente humano quando o usuário pedir para falar com uma pessoa ou quando não for possível resolver o atendimento."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"motivo",
+				},
+				"properties": map[string]interface{}{
+					"motivo": map[string]string{
+						"type":        "string",
+						"description": "Resumo do que o usuário precisa",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) RequestHandoff(request HandoffRequest) string {
+	NotifyStaff(Notification{
+		Event:    EventHandoff,
+		Message:  RenderMessage("atendente_solicitado", MessageData{Customer: chat.Fullname, Phone: chat.Number, Reason: request.Motivo}),
+		Customer: chat.Fullname,
+		Phone:    chat.Number,
+	})
+
+	return "atendente avisado, informe ao usuário que um atendente vai responder em breve"
+}
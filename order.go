@@ -1,5 +1,15 @@
 package main
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
 type Produto struct {
 	IdProduto   string `json:"id_produto"`
 	NomeProduto string `json:"nome_produto"`
@@ -9,9 +19,341 @@ type Produto struct {
 }
 
 type OrdemDeCompra struct {
-	Produtos         []Produto `json:"produtos"`
-	ValorTotal       string    `json:"valor_total"`
-	NomeCompleto     string    `json:"nome_completo"`
-	Endereco         string    `json:"endereco"`
-	FormaDePagamento string    `json:"forma_de_pagamento"`
+	Produtos         []Produto  `json:"produtos"`
+	ValorTotal       string     `json:"valor_total"`
+	NomeCompleto     string     `json:"nome_completo"`
+	Endereco         string     `json:"endereco"`
+	FormaDePagamento string     `json:"forma_de_pagamento"`
+	Subtotal         Money      `json:"subtotal"`
+	TaxaEntrega      Money      `json:"taxa_entrega"`
+	ZonaEntrega      string     `json:"zona_entrega"`
+	AjustePagamento  Money      `json:"ajuste_pagamento"`
+	TrocoPara        Money      `json:"troco_para"`
+	Descontos        []Desconto `json:"descontos"`
+	Desconto         Money      `json:"desconto"`
+	Cupom            string     `json:"cupom"`
+	PrimeiroPedido   bool       `json:"primeiro_pedido"`
+	AgendadoPara     *time.Time `json:"agendado_para"`
+	Troco            Money      `json:"troco"`
+
+	EnderecoEstruturado *Endereco `json:"endereco_estruturado"`
+}
+
+// prices the items with the catalog, applies the promotions and sums the delivery fee and payment adjustment, the model total is never trusted
+func (order *OrdemDeCompra) Recompute(delivery *DeliveryQuote) {
+	order.Subtotal = 0
+	for i, product := range order.Produtos {
+		price, _ := ParseMoney(product.Valor)
+		if catalogProduct, found := Vault.Products.Find(product.IdProduto); found {
+			price = catalogProduct.Preco
+			order.Produtos[i].Valor = price.String()
+		}
+
+		order.Subtotal += price * Money(product.Quantidade)
+	}
+
+	order.Descontos = ApplyPromotions(*order, time.Now())
+	order.Desconto = 0
+	for _, discount := range order.Descontos {
+		order.Desconto += discount.Valor
+	}
+
+	order.TaxaEntrega = 0
+	order.ZonaEntrega = ""
+	if delivery != nil {
+		order.TaxaEntrega = delivery.FeeFor(order.Subtotal)
+		order.ZonaEntrega = delivery.Zone
+	}
+
+	order.AjustePagamento = 0
+	if method, found := FindPaymentMethod(order.FormaDePagamento); found {
+		order.AjustePagamento = method.Adjustment(order.Subtotal - order.Desconto)
+	}
+
+	order.ValorTotal = order.Total().String()
+}
+
+func (order OrdemDeCompra) Total() Money {
+	return order.Subtotal - order.Desconto + order.TaxaEntrega + order.AjustePagamento
+}
+
+// change the delivery person must bring, the customer pays with TrocoPara
+func (order *OrdemDeCompra) ComputeChange(method PaymentMethod) error {
+	order.Troco = 0
+	if !method.AsksChange {
+		order.TrocoPara = 0
+		return nil
+	}
+
+	if order.TrocoPara == 0 {
+		return fmt.Errorf("pergunte ao usuário para quanto precisa de troco, se não precisar envie troco_para com o valor total %s", order.Total())
+	}
+
+	if order.TrocoPara < order.Total() {
+		return fmt.Errorf("troco para %s é menor que o valor total %s, confirme o valor com o usuário", order.TrocoPara, order.Total())
+	}
+
+	order.Troco = order.TrocoPara - order.Total()
+	return nil
+}
+
+// parts of the total as told to the user
+func (order OrdemDeCompra) Breakdown() string {
+	parts := fmt.Sprintf("produtos %s + entrega %s", order.Subtotal, order.TaxaEntrega)
+	for _, discount := range order.Descontos {
+		parts = fmt.Sprintf("%s - %s %s", parts, discount.Descricao, discount.Valor)
+	}
+
+	if order.AjustePagamento < 0 {
+		parts = fmt.Sprintf("%s - desconto %s", parts, -order.AjustePagamento)
+	} else if order.AjustePagamento > 0 {
+		parts = fmt.Sprintf("%s + acréscimo %s", parts, order.AjustePagamento)
+	}
+
+	return parts
+}
+
+// quote of a stored order, quoted again from its address when possible
+func (order OrdemDeCompra) DeliveryQuote() *DeliveryQuote {
+	if order.EnderecoEstruturado != nil && Vault.Config.Delivery.Enabled() {
+		quote, err := Vault.Config.Delivery.Quote(order.EnderecoEstruturado.Bairro, order.EnderecoEstruturado.CEP, nil)
+		if err == nil {
+			return &quote
+		}
+	}
+
+	if order.ZonaEntrega == "" && order.TaxaEntrega == 0 {
+		return nil
+	}
+
+	return &DeliveryQuote{Zone: order.ZonaEntrega, Fee: order.TaxaEntrega}
+}
+
+type StoredOrder struct {
+	ID      int
+	Created time.Time
+	Updated time.Time
+	Status  string
+	Version int
+	Paid    bool
+	Order   OrdemDeCompra
+}
+
+func (chat *WhatsAppChat) FinishCheckout() (string, bool) {
+	// each cart is placed once, a repeated call would save the order, redeem coupons and decrement stock again
+	if chat.PlacedOrderID != 0 {
+		return fmt.Sprintf("o pedido #%d já foi registrado, não chame finalizar_checkout novamente. Para mudar o pedido use alterar_pedido", chat.PlacedOrderID), true
+	}
+
+	var order OrdemDeCompra
+	if err := GetToolArgs(chat.ToolCall, &order); err != nil {
+		return fmt.Sprintf("argumentos inválidos: %s", err), false
+	}
+
+	// the cart filled by repetir_ultimo_pedido is the default
+	if len(order.Produtos) == 0 && len(chat.Cart) > 0 {
+		order.Produtos = chat.Cart
+	}
+
+	order.Cupom = chat.Coupon
+	order.AgendadoPara = chat.DeliverySlot
+	order.PrimeiroPedido = chat.Customer == nil || chat.Customer.OrderCount == 0
+	if chat.ConfirmedAddress != nil {
+		order.EnderecoEstruturado = chat.ConfirmedAddress
+		order.Endereco = chat.ConfirmedAddress.String()
+	}
+	deliveryErr := chat.QuoteConfirmedAddress()
+	order.Recompute(chat.Delivery)
+
+	method, found := FindPaymentMethod(order.FormaDePagamento)
+	checkout := Checkout{Chat: chat, Order: &order, Delivery: chat.Delivery, DeliveryError: deliveryErr, Method: method, MethodFound: found}
+	if violations := checkout.Validate(); len(violations) > 0 {
+		return fmt.Sprintf("pedido não finalizado, resolva com o usuário e chame finalizar_checkout novamente:\n- %s", strings.Join(violations, "\n- ")), false
+	}
+
+	chat.Order = order
+	status := OrderReceived
+	if Vault.Config.Approval.Enabled {
+		status = OrderAwaitingApproval
+	}
+	orderID := SaveOrder(chat.Number, chat.Order, status, chat.DeliverySlot)
+	chat.PlacedOrderID = orderID
+	chat.Cart = nil
+	RedeemCoupons(orderID, chat.Number, chat.Order.Descontos)
+	DecrementStock(chat.Order.Produtos)
+
+	chat.Customer = RegisterCustomerOrder(chat.Number, chat.Order)
+
+	chat.Fullname = chat.Order.NomeCompleto
+	data := MessageData{
+		OrderID:  orderID,
+		Customer: chat.Fullname,
+		Phone:    chat.Number,
+		Order:    chat.Order,
+	}
+
+	if method.ReceiptRequired {
+		mediaType := "image"
+		if chat.Receipt.MediaType == "documentMessage" {
+			mediaType = "document"
+		}
+		NotifyStaff(Notification{
+			Event:    EventReceipt,
+			Message:  RenderMessage("comprovante", data),
+			OrderID:  orderID,
+			Customer: chat.Fullname,
+			Phone:    chat.Number,
+			Media: &NotificationMedia{
+				Content:   []byte(chat.Receipt.Base64),
+				MediaType: mediaType,
+				MimeType:  chat.Receipt.MimeType,
+				FileName:  fmt.Sprintf("Comprovante de %s", chat.Fullname),
+			},
+		})
+	}
+
+	// a receipt proves a single order
+	chat.Receipt = EvolutionMedia{}
+	chat.AwaitingReceipt = false
+
+	NotifyStaff(Notification{
+		Event:    EventNewOrder,
+		Message:  RenderMessage("pedido_novo", data),
+		OrderID:  orderID,
+		Customer: chat.Fullname,
+		Phone:    chat.Number,
+	})
+
+	summary := fmt.Sprintf("no valor total de %s (%s)", chat.Order.ValorTotal, chat.Order.Breakdown())
+	if chat.Order.AgendadoPara != nil {
+		summary = fmt.Sprintf("%s, agendado para %s", summary, chat.Order.AgendadoPara.Format("02/01 às 15:04"))
+	}
+
+	if status == OrderAwaitingApproval {
+		RequestOrderApproval(orderID, chat.Fullname)
+		if method.Online {
+			return fmt.Sprintf("pedido #%d registrado %s e aguardando aprovação da loja. Não diga que o pedido está confirmado, informe que a confirmação e o link de pagamento serão enviados em breve", orderID, summary), true
+		}
+
+		return fmt.Sprintf("pedido #%d registrado %s e aguardando aprovação da loja. Não diga que o pedido está confirmado, informe que a confirmação será enviada em breve", orderID, summary), true
+	}
+
+	if method.Online {
+		if err := RequestOnlinePayment(orderID, chat.Number, chat.Order); err != nil {
+			fmt.Printf("Warning: can't create charge for order %d: %s\n", orderID, err)
+			NotifyError(fmt.Sprintf("Erro ao gerar o link de pagamento do pedido #%d: %s", orderID, err), chat.Number)
+			return fmt.Sprintf("pedido #%d recebido %s, mas o link de pagamento não pôde ser gerado. Informe que a loja vai entrar em contato para o pagamento", orderID, summary), true
+		}
+
+		return fmt.Sprintf("pedido #%d recebido %s, o link de pagamento foi enviado ao usuário e o pedido será confirmado assim que o pagamento for aprovado", orderID, summary), true
+	}
+
+	return fmt.Sprintf("pedido #%d recebido %s, pagamento: %s", orderID, summary, method.Label), true
+}
+
+// delivery slot only for slots that passed the capacity check
+func SaveOrder(phoneNumber string, order OrdemDeCompra, status string, deliverySlot *time.Time) int {
+	marshed, err := json.Marshal(order)
+	failOnError(err, "Failed to marshal order")
+
+	var id int
+	err = Vault.PGX.QueryRow(
+		context.Background(),
+		"INSERT INTO orders (phone_number, data, status, delivery_slot) VALUES ($1, $2, $3, $4) RETURNING id",
+		phoneNumber,
+		marshed,
+		status,
+		deliverySlot,
+	).Scan(&id)
+	failOnError(err, "Can't save order")
+
+	return id
+}
+
+// most recent orders of a phone number, newest first
+func LoadOrders(phoneNumber string, limit int) []StoredOrder {
+	rows, err := Vault.PGX.Query(
+		context.Background(),
+		"SELECT id, created, updated, status, version, paid, data FROM orders WHERE phone_number = $1 ORDER BY created DESC LIMIT $2",
+		phoneNumber,
+		limit,
+	)
+	failOnError(err, "Can't load orders")
+	defer rows.Close()
+
+	orders := []StoredOrder{}
+	for rows.Next() {
+		var stored StoredOrder
+		var data []byte
+		err = rows.Scan(&stored.ID, &stored.Created, &stored.Updated, &stored.Status, &stored.Version, &stored.Paid, &data)
+		failOnError(err, "Can't scan order")
+
+		err = json.Unmarshal(data, &stored.Order)
+		failOnError(err, "Can't parse order")
+
+		orders = append(orders, stored)
+	}
+	failOnError(rows.Err(), "Can't read orders")
+
+	return orders
+}
+
+// loads an order only when it belongs to the phone number
+func LoadOrder(phoneNumber string, orderID int) *StoredOrder {
+	return loadOrder("SELECT id, created, updated, status, version, paid, data FROM orders WHERE phone_number = $1 AND id = $2", phoneNumber, orderID)
+}
+
+// any customer order, for the owner and background jobs
+func LoadOrderByID(orderID int) *StoredOrder {
+	return loadOrder("SELECT id, created, updated, status, version, paid, data FROM orders WHERE id = $1", orderID)
+}
+
+func loadOrder(query string, args ...any) *StoredOrder {
+	stored := StoredOrder{}
+	var data []byte
+
+	err := Vault.PGX.QueryRow(context.Background(), query, args...).Scan(&stored.ID, &stored.Created, &stored.Updated, &stored.Status, &stored.Version, &stored.Paid, &data)
+	if err == pgx.ErrNoRows {
+		return nil
+	}
+	failOnError(err, "Can't load order")
+
+	err = json.Unmarshal(data, &stored.Order)
+	failOnError(err, "Can't parse order")
+
+	return &stored
+}
+
+// keeps the current data as a version and replaces it with the new order
+func SaveOrderVersion(stored StoredOrder, order OrdemDeCompra) {
+	marshed, err := json.Marshal(order)
+	failOnError(err, "Failed to marshal order")
+
+	previous, err := json.Marshal(stored.Order)
+	failOnError(err, "Failed to marshal order")
+
+	tx, err := Vault.PGX.Begin(context.Background())
+	failOnError(err, "Can't start order version transaction")
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(
+		context.Background(),
+		"INSERT INTO order_versions (order_id, version, status, data) VALUES ($1, $2, $3, $4)",
+		stored.ID,
+		stored.Version,
+		stored.Status,
+		previous,
+	)
+	failOnError(err, "Can't save order version")
+
+	_, err = tx.Exec(
+		context.Background(),
+		"UPDATE orders SET data = $2, version = version + 1, updated = now() WHERE id = $1",
+		stored.ID,
+		marshed,
+	)
+	failOnError(err, "Can't update order")
+
+	err = tx.Commit(context.Background())
+	failOnError(err, "Can't commit order version")
 }
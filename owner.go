@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func IsOwnerCommand(phoneNumber string, text string) bool {
+	return phoneNumber == Vault.OwnerNumber && strings.HasPrefix(strings.TrimSpace(text), "/")
+}
+
+func HandleOwnerCommand(text string) {
+	fields := strings.Fields(strings.TrimSpace(text))
+	command := strings.ToLower(strings.TrimPrefix(fields[0], "/"))
+	args := fields[1:]
+
+	var reply string
+	switch command {
+	case "status":
+		reply = ownerSetStatus(args)
+	case "cancelar":
+		reply = ownerCancel(args)
+	case "manter":
+		reply = ownerKeep(args)
+	case "aprovar":
+		reply = ownerApprove(args)
+	case "rejeitar":
+		reply = ownerReject(args)
+	case "estoque":
+		reply = ownerStock(args)
+	default:
+		reply = ownerHelp()
+	}
+
+	SendMessageToNumber(Vault.OwnerNumber, reply)
+}
+
+func ownerHelp() string {
+	return strings.Join([]string{
+		"Comandos disponíveis:",
+		fmt.Sprintf("/status <pedido> <%s>", strings.Join(orderStatuses, "|")),
+		"/cancelar <pedido> - cancela o pedido ou aprova o cancelamento solicitado",
+		"/manter <pedido> - recusa o cancelamento solicitado",
+		"/aprovar <pedido> - aprova o pedido aguardando aprovação",
+		"/rejeitar <pedido> <motivo> - recusa o pedido aguardando aprovação",
+		"/estoque - lista o estoque",
+		"/estoque <produto> [variação] <quantidade> - define o estoque",
+	}, "\n")
+}
+
+func ownerApprove(args []string) string {
+	if len(args) != 1 {
+		return ownerHelp()
+	}
+
+	orderID, err := parseOrderID(args[0])
+	if err != nil {
+		return err.Error()
+	}
+
+	if _, err := ApproveOrder(orderID); err != nil {
+		return err.Error()
+	}
+
+	return fmt.Sprintf("Pedido #%d aprovado", orderID)
+}
+
+func ownerReject(args []string) string {
+	if len(args) < 1 {
+		return ownerHelp()
+	}
+
+	orderID, err := parseOrderID(args[0])
+	if err != nil {
+		return err.Error()
+	}
+
+	reason := strings.TrimSpace(strings.Join(args[1:], " "))
+	if reason == "" {
+		return fmt.Sprintf("Informe o motivo para o cliente: /rejeitar %d <motivo>", orderID)
+	}
+
+	if _, err := RejectOrder(orderID, reason); err != nil {
+		return err.Error()
+	}
+
+	return fmt.Sprintf("Pedido #%d recusado", orderID)
+}
+
+func parseOrderID(arg string) (int, error) {
+	orderID, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		return 0, fmt.Errorf("número de pedido inválido: %s", arg)
+	}
+
+	return orderID, nil
+}
+
+func ownerCancel(args []string) string {
+	if len(args) != 1 {
+		return ownerHelp()
+	}
+
+	orderID, err := parseOrderID(args[0])
+	if err != nil {
+		return err.Error()
+	}
+
+	phoneNumber, err := CancelOrder(orderID)
+	if err != nil {
+		return err.Error()
+	}
+
+	SendMessageToNumber(phoneNumber, RenderMessage("pedido_cancelado", MessageData{OrderID: orderID}))
+	return fmt.Sprintf("Pedido #%d cancelado", orderID)
+}
+
+func ownerKeep(args []string) string {
+	if len(args) != 1 {
+		return ownerHelp()
+	}
+
+	orderID, err := parseOrderID(args[0])
+	if err != nil {
+		return err.Error()
+	}
+
+	phoneNumber, err := TransitionOrderStatus(orderID, OrderCancelRequested, OrderReceived)
+	if err != nil {
+		return err.Error()
+	}
+
+	SendMessageToNumber(phoneNumber, RenderMessage("cancelamento_recusado", MessageData{OrderID: orderID}))
+	return fmt.Sprintf("Cancelamento do pedido #%d recusado", orderID)
+}
+
+func ownerSetStatus(args []string) string {
+	if len(args) != 2 {
+		return ownerHelp()
+	}
+
+	orderID, err := parseOrderID(args[0])
+	if err != nil {
+		return err.Error()
+	}
+
+	status := strings.ToLower(args[1])
+	phoneNumber, err := UpdateOrderStatus(orderID, status)
+	if err != nil {
+		return err.Error()
+	}
+
+	SendMessageToNumber(phoneNumber, RenderMessage("status_atualizado", MessageData{OrderID: orderID, Status: status}))
+	return fmt.Sprintf("Pedido #%d atualizado para %s", orderID, OrderStatusLabel(status))
+}
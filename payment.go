@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// adjustment_percent is applied over the products, negative values are discounts
+type PaymentMethod struct {
+	ID                string   `json:"id"`
+	Label             string   `json:"label"`
+	ReceiptRequired   bool     `json:"receipt_required"`
+	AdjustmentPercent float64  `json:"adjustment_percent"`
+	PayOnDelivery     bool     `json:"pay_on_delivery"`
+	AsksChange        bool     `json:"asks_change"`
+	Online            bool     `json:"online"`
+	MinTotal          Money    `json:"min_total"`
+	MaxTotal          Money    `json:"max_total"`
+	Zones             []string `json:"zones"`
+}
+
+func DefaultPaymentMethods() []PaymentMethod {
+	return []PaymentMethod{
+		{ID: "cartao_de_credito", Label: "Cartão de crédito", PayOnDelivery: true},
+		{ID: "cartao_de_debito", Label: "Cartão de débito", PayOnDelivery: true},
+		{ID: "dinheiro", Label: "Dinheiro", PayOnDelivery: true, AsksChange: true},
+		{ID: "pix", Label: "Pix", ReceiptRequired: true},
+	}
+}
+
+func ValidatePaymentMethods(methods []PaymentMethod, gateway PaymentGatewayConfig) error {
+	if len(methods) == 0 {
+		return fmt.Errorf("at least one payment method is required")
+	}
+
+	ids := []string{}
+	for _, method := range methods {
+		if method.ID == "" || method.Label == "" {
+			return fmt.Errorf("payment method without id or label")
+		}
+
+		if method.Online && !gateway.Enabled() {
+			return fmt.Errorf("payment method %s is online but there is no payment gateway", method.ID)
+		}
+
+		if slices.Contains(ids, method.ID) {
+			return fmt.Errorf("duplicated payment method %s", method.ID)
+		}
+		ids = append(ids, method.ID)
+	}
+
+	return nil
+}
+
+func FindPaymentMethod(id string) (PaymentMethod, bool) {
+	index := slices.IndexFunc(Vault.Config.PaymentMethods, func(method PaymentMethod) bool { return method.ID == id })
+	if index < 0 {
+		return PaymentMethod{}, false
+	}
+
+	return Vault.Config.PaymentMethods[index], true
+}
+
+func PaymentMethodIDs() []string {
+	ids := []string{}
+	for _, method := range Vault.Config.PaymentMethods {
+		ids = append(ids, method.ID)
+	}
+
+	return ids
+}
+
+func PaymentLabel(id string) string {
+	if method, found := FindPaymentMethod(id); found {
+		return method.Label
+	}
+
+	return id
+}
+
+// checks the availability rules against the order products and delivery zone
+func (method PaymentMethod) Available(subtotal Money, zone string) error {
+	if method.MinTotal > 0 && subtotal < method.MinTotal {
+		return fmt.Errorf("%s disponível apenas para pedidos a partir de %s", method.Label, method.MinTotal)
+	}
+
+	if method.MaxTotal > 0 && subtotal > method.MaxTotal {
+		return fmt.Errorf("%s disponível apenas para pedidos até %s", method.Label, method.MaxTotal)
+	}
+
+	if len(method.Zones) > 0 && !slices.ContainsFunc(method.Zones, func(name string) bool { return normalizeText(name) == normalizeText(zone) }) {
+		return fmt.Errorf("%s não disponível para a região de entrega", method.Label)
+	}
+
+	return nil
+}
+
+func (method PaymentMethod) Adjustment(subtotal Money) Money {
+	return subtotal.Percent(method.AdjustmentPercent)
+}
+
+// summary of the methods and their rules for the tool description
+func (method PaymentMethod) Describe() string {
+	details := []string{}
+	if method.AdjustmentPercent < 0 {
+		details = append(details, fmt.Sprintf("%g%% de desconto", -method.AdjustmentPercent))
+	} else if method.AdjustmentPercent > 0 {
+		details = append(details, fmt.Sprintf("acréscimo de %g%%", method.AdjustmentPercent))
+	}
+
+	if method.PayOnDelivery {
+		details = append(details, "pago na entrega")
+	}
+
+	if method.ReceiptRequired {
+		details = append(details, "exige comprovante")
+	}
+
+	if method.Online {
+		details = append(details, "link de pagamento enviado após o pedido")
+	}
+
+	if method.AsksChange {
+		details = append(details, "perguntar troco para quanto")
+	}
+
+	if method.MinTotal > 0 {
+		details = append(details, fmt.Sprintf("a partir de %s", method.MinTotal))
+	}
+
+	if method.MaxTotal > 0 {
+		details = append(details, fmt.Sprintf("até %s", method.MaxTotal))
+	}
+
+	if len(method.Zones) > 0 {
+		details = append(details, fmt.Sprintf("apenas para %s", strings.Join(method.Zones, ", ")))
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("%s (%s)", method.ID, method.Label)
+	}
+
+	return fmt.Sprintf("%s (%s: %s)", method.ID, method.Label, strings.Join(details, ", "))
+}
+
+func describePaymentMethods() string {
+	descriptions := []string{}
+	for _, method := range Vault.Config.PaymentMethods {
+		descriptions = append(descriptions, method.Describe())
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+type PaymentChoiceRequest struct {
+	FormaDePagamento string `json:"forma_de_pagamento"`
+}
+
+func choosePaymentTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "escolher_forma_de_pagamento",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Registra a forma de pagamento assim que o usuário escolher, antes de pedir o comprovante ou finalizar o pedido."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"forma_de_pagamento",
+				},
+				"properties": map[string]interface{}{
+					"forma_de_pagamento": map[string]interface{}{
+						"type":        "string",
+						"description": fmt.Sprintf("A forma de pagamento escolhida pelo usuário. Opções: %s", describePaymentMethods()),
+						"enum":        PaymentMethodIDs(),
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// images and files sent after choosing a method that requires a receipt are taken as the receipt
+func (chat *WhatsAppChat) ChoosePaymentMethod(request PaymentChoiceRequest) string {
+	method, found := FindPaymentMethod(request.FormaDePagamento)
+	if !found {
+		return fmt.Sprintf("forma de pagamento %s não aceita, opções: %s", request.FormaDePagamento, describePaymentMethods())
+	}
+
+	chat.AwaitingReceipt = method.ReceiptRequired && chat.Receipt.Base64 == ""
+	if chat.AwaitingReceipt {
+		return fmt.Sprintf("forma de pagamento %s registrada (%s), peça ao usuário para enviar o comprovante", method.Label, method.Describe())
+	}
+
+	return fmt.Sprintf("forma de pagamento %s registrada (%s)", method.Label, method.Describe())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+type ProductPhotoRequest struct {
+	IdProduto string `json:"id_produto"`
+}
+
+func sendProductPhotoTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "enviar_foto_produto",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Envia as fotos de um produto para o usuário, com nome e preço na legenda. Deve ser chamado quando o usuário pedir para ver um produto."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"id_produto",
+				},
+				"properties": map[string]interface{}{
+					"id_produto": map[string]string{
+						"type":        "string",
+						"description": "Identificador único do produto, ou o nome do produto quando o identificador não for conhecido",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) SendProductPhotos(request ProductPhotoRequest) string {
+	product, found := Vault.Products.Find(request.IdProduto)
+	if !found {
+		return fmt.Sprintf("produto %s não encontrado no catálogo", request.IdProduto)
+	}
+
+	if len(product.Fotos) == 0 {
+		return fmt.Sprintf("o produto %s não possui fotos", product.Nome)
+	}
+
+	remaining := Vault.Config.MaxPhotosPerTurn - chat.PhotosSentInTurn
+	if remaining <= 0 {
+		return "limite de fotos por mensagem atingido, envie as demais depois que o usuário responder"
+	}
+
+	caption := fmt.Sprintf("%s - %s", product.Nome, product.Preco)
+	sent := 0
+	for _, photo := range product.Fotos {
+		if sent >= remaining {
+			break
+		}
+
+		path := Vault.Products.PhotoPath(photo)
+		file, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Warning: can't open product photo %s: %s\n", path, err)
+			continue
+		}
+
+		mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+		SendMediaToNumber(chat.Number, file, "image", mimeType, filepath.Base(path), caption, true)
+		sent++
+	}
+
+	chat.PhotosSentInTurn += sent
+	if sent == 0 {
+		return fmt.Sprintf("não foi possível enviar as fotos de %s", product.Nome)
+	}
+
+	if sent < len(product.Fotos) {
+		return fmt.Sprintf("%d de %d fotos de %s enviadas, limite de fotos por mensagem atingido", sent, len(product.Fotos), product.Nome)
+	}
+
+	return fmt.Sprintf("%d foto(s) de %s enviada(s)", sent, product.Nome)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	typingRefreshInterval = 8 * time.Second
+	maxTypingDelay        = 6 * time.Second
+)
+
+func (chat WhatsAppChat) MarkAsRead(messageID string) {
+	if messageID == "" {
+		return
+	}
+
+	_, _, err := EvolutionRequest("chat/markMessageAsRead", map[string]any{
+		"readMessages": []map[string]any{
+			{
+				"remoteJid": fmt.Sprintf("%s@s.whatsapp.net", chat.Number),
+				"fromMe":    false,
+				"id":        messageID,
+			},
+		},
+	})
+	if err != nil {
+		fmt.Printf("Warning: can't mark message %s as read: %s\n", messageID, err)
+	}
+}
+
+func (chat WhatsAppChat) SendPresence(presence string, delay time.Duration) {
+	_, _, err := EvolutionRequest("chat/sendPresence", map[string]any{
+		"number":   chat.Number,
+		"presence": presence,
+		"delay":    delay.Milliseconds(),
+	})
+	if err != nil {
+		fmt.Printf("Warning: can't send presence %s to %s: %s\n", presence, chat.Number, err)
+	}
+}
+
+// keeps the "composing" presence alive until the returned stop is called
+func (chat WhatsAppChat) StartTyping() func() {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(typingRefreshInterval)
+		defer ticker.Stop()
+
+		chat.SendPresence("composing", typingRefreshInterval)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				chat.SendPresence("composing", typingRefreshInterval)
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() {
+			close(done)
+			chat.SendPresence("paused", 0)
+		})
+	}
+}
+
+// simulated typing time for a reply, proportional to its length
+func TypingDelay(message string) time.Duration {
+	delay := time.Duration(len([]rune(message))) * Vault.TypingDelayPerChar
+	return min(delay, maxTypingDelay)
+}
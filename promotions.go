@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	PromotionBuyXPayY = "leve_pague"
+	PromotionPercent  = "percentual"
+	PromotionFixed    = "valor_fixo"
+)
+
+// promotions without coupon apply to every order that meets the conditions
+type Promotion struct {
+	ID                 string   `json:"id"`
+	Name               string   `json:"name"`
+	Type               string   `json:"type"`
+	Coupon             string   `json:"coupon"`
+	Products           []string `json:"products"`
+	Categories         []string `json:"categories"`
+	Buy                int      `json:"buy"`
+	Pay                int      `json:"pay"`
+	Percent            float64  `json:"percent"`
+	Amount             Money    `json:"amount"`
+	MinSubtotal        Money    `json:"min_subtotal"`
+	FirstOrder         bool     `json:"first_order"`
+	Expires            string   `json:"expires"`
+	MaxUses            int      `json:"max_uses"`
+	MaxUsesPerCustomer int      `json:"max_uses_per_customer"`
+}
+
+type Desconto struct {
+	Promocao  string `json:"promocao"`
+	Descricao string `json:"descricao"`
+	Valor     Money  `json:"valor"`
+}
+
+type CouponRequest struct {
+	Codigo string `json:"codigo"`
+}
+
+func ValidatePromotions(promotions []Promotion) error {
+	ids := []string{}
+	coupons := []string{}
+	for _, promotion := range promotions {
+		if promotion.ID == "" || promotion.Name == "" {
+			return fmt.Errorf("promotion without id or name")
+		}
+
+		if slices.Contains(ids, promotion.ID) {
+			return fmt.Errorf("duplicated promotion %s", promotion.ID)
+		}
+		ids = append(ids, promotion.ID)
+
+		if promotion.Coupon != "" {
+			code := strings.ToUpper(promotion.Coupon)
+			if slices.Contains(coupons, code) {
+				return fmt.Errorf("duplicated coupon %s", promotion.Coupon)
+			}
+			coupons = append(coupons, code)
+		}
+
+		switch promotion.Type {
+		case PromotionBuyXPayY:
+			if promotion.Buy <= promotion.Pay || promotion.Pay < 0 {
+				return fmt.Errorf("promotion %s must have buy greater than pay", promotion.ID)
+			}
+		case PromotionPercent:
+			if promotion.Percent <= 0 || promotion.Percent > 100 {
+				return fmt.Errorf("promotion %s percent must be between 0 and 100", promotion.ID)
+			}
+		case PromotionFixed:
+			if promotion.Amount <= 0 {
+				return fmt.Errorf("promotion %s without amount", promotion.ID)
+			}
+		default:
+			return fmt.Errorf("promotion %s with unknown type %s", promotion.ID, promotion.Type)
+		}
+
+		if _, err := promotion.ExpiresAt(); err != nil {
+			return fmt.Errorf("promotion %s: %w", promotion.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// end of the expiry day, zero when the promotion doesn't expire
+func (promotion Promotion) ExpiresAt() (time.Time, error) {
+	if promotion.Expires == "" {
+		return time.Time{}, nil
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", promotion.Expires, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expires %s, use YYYY-MM-DD", promotion.Expires)
+	}
+
+	return day.AddDate(0, 0, 1), nil
+}
+
+func (promotion Promotion) Expired(now time.Time) bool {
+	expires, _ := promotion.ExpiresAt()
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+func (promotion Promotion) Eligible(product Produto) bool {
+	if len(promotion.Products) == 0 && len(promotion.Categories) == 0 {
+		return true
+	}
+
+	if slices.Contains(promotion.Products, product.IdProduto) {
+		return true
+	}
+
+	catalogProduct, found := Vault.Products.Find(product.IdProduto)
+	return found && slices.ContainsFunc(promotion.Categories, func(category string) bool {
+		return normalizeText(category) == normalizeText(catalogProduct.Categoria)
+	})
+}
+
+// discount over the products already priced by Recompute, zero when the conditions aren't met
+func (promotion Promotion) Discount(order OrdemDeCompra) Money {
+	if promotion.FirstOrder && !order.PrimeiroPedido {
+		return 0
+	}
+
+	if promotion.MinSubtotal > 0 && order.Subtotal < promotion.MinSubtotal {
+		return 0
+	}
+
+	unitPrices := []Money{}
+	eligible := Money(0)
+	for _, product := range order.Produtos {
+		if !promotion.Eligible(product) {
+			continue
+		}
+
+		price, _ := ParseMoney(product.Valor)
+		eligible += price * Money(product.Quantidade)
+		for range product.Quantidade {
+			unitPrices = append(unitPrices, price)
+		}
+	}
+
+	if eligible == 0 {
+		return 0
+	}
+
+	switch promotion.Type {
+	case PromotionBuyXPayY:
+		// the cheapest units are the free ones
+		sort.Slice(unitPrices, func(i, j int) bool { return unitPrices[i] < unitPrices[j] })
+		free := len(unitPrices) / promotion.Buy * (promotion.Buy - promotion.Pay)
+		discount := Money(0)
+		for _, price := range unitPrices[:free] {
+			discount += price
+		}
+		return discount
+	case PromotionPercent:
+		return eligible.Percent(promotion.Percent)
+	case PromotionFixed:
+		return min(promotion.Amount, eligible)
+	}
+
+	return 0
+}
+
+// automatic promotions plus the coupon of the order, never more than the products value
+func ApplyPromotions(order OrdemDeCompra, now time.Time) []Desconto {
+	discounts := []Desconto{}
+	total := Money(0)
+	for _, promotion := range Vault.Config.Promotions {
+		if promotion.Expired(now) {
+			continue
+		}
+
+		if promotion.Coupon != "" && !strings.EqualFold(promotion.Coupon, order.Cupom) {
+			continue
+		}
+
+		discount := min(promotion.Discount(order), order.Subtotal-total)
+		if discount <= 0 {
+			continue
+		}
+
+		total += discount
+		discounts = append(discounts, Desconto{Promocao: promotion.ID, Descricao: promotion.Name, Valor: discount})
+	}
+
+	return discounts
+}
+
+func FindCoupon(code string) (Promotion, bool) {
+	code = strings.TrimSpace(code)
+	index := slices.IndexFunc(Vault.Config.Promotions, func(promotion Promotion) bool {
+		return promotion.Coupon != "" && strings.EqualFold(promotion.Coupon, code)
+	})
+	if index < 0 {
+		return Promotion{}, false
+	}
+
+	return Vault.Config.Promotions[index], true
+}
+
+// cancelled and rejected orders don't count as uses
+func couponUses(promotionID string, phoneNumber string) (int, int) {
+	var total, customer int
+	err := Vault.PGX.QueryRow(
+		context.Background(),
+		`SELECT count(*), count(*) FILTER (WHERE r.phone_number = $2)
+		FROM coupon_redemptions r JOIN orders o ON o.id = r.order_id
+		WHERE r.promotion_id = $1 AND o.status NOT IN ($3, $4)`,
+		promotionID,
+		phoneNumber,
+		OrderCancelled,
+		OrderRejected,
+	).Scan(&total, &customer)
+	failOnError(err, "Can't count coupon uses")
+
+	return total, customer
+}
+
+func ValidateCoupon(code string, phoneNumber string, now time.Time) (Promotion, error) {
+	promotion, found := FindCoupon(code)
+	if !found {
+		return Promotion{}, fmt.Errorf("cupom %s não existe", code)
+	}
+
+	if promotion.Expired(now) {
+		return Promotion{}, fmt.Errorf("cupom %s expirado", promotion.Coupon)
+	}
+
+	if promotion.MaxUses > 0 || promotion.MaxUsesPerCustomer > 0 {
+		total, customer := couponUses(promotion.ID, phoneNumber)
+		if promotion.MaxUses > 0 && total >= promotion.MaxUses {
+			return Promotion{}, fmt.Errorf("cupom %s esgotado", promotion.Coupon)
+		}
+
+		if promotion.MaxUsesPerCustomer > 0 && customer >= promotion.MaxUsesPerCustomer {
+			return Promotion{}, fmt.Errorf("cupom %s já utilizado por este usuário", promotion.Coupon)
+		}
+	}
+
+	return promotion, nil
+}
+
+func RedeemCoupons(orderID int, phoneNumber string, discounts []Desconto) {
+	for _, discount := range discounts {
+		index := slices.IndexFunc(Vault.Config.Promotions, func(promotion Promotion) bool { return promotion.ID == discount.Promocao })
+		if index < 0 || Vault.Config.Promotions[index].Coupon == "" {
+			continue
+		}
+		promotion := Vault.Config.Promotions[index]
+
+		_, err := Vault.PGX.Exec(
+			context.Background(),
+			"INSERT INTO coupon_redemptions (promotion_id, phone_number, order_id) VALUES ($1, $2, $3)",
+			promotion.ID,
+			phoneNumber,
+			orderID,
+		)
+		failOnError(err, "Can't save coupon redemption")
+	}
+}
+
+// conditions of the promotion for the model, so it never promises more than the engine gives
+func (promotion Promotion) Describe() string {
+	var rule string
+	switch promotion.Type {
+	case PromotionBuyXPayY:
+		rule = fmt.Sprintf("leve %d pague %d", promotion.Buy, promotion.Pay)
+	case PromotionPercent:
+		rule = fmt.Sprintf("%g%% de desconto", promotion.Percent)
+	case PromotionFixed:
+		rule = fmt.Sprintf("%s de desconto", promotion.Amount)
+	}
+
+	conditions := []string{}
+	if len(promotion.Products) > 0 || len(promotion.Categories) > 0 {
+		conditions = append(conditions, fmt.Sprintf("válido para %s", strings.Join(append(slices.Clone(promotion.Categories), promotion.Products...), ", ")))
+	}
+
+	if promotion.MinSubtotal > 0 {
+		conditions = append(conditions, fmt.Sprintf("em compras a partir de %s", promotion.MinSubtotal))
+	}
+
+	if promotion.FirstOrder {
+		conditions = append(conditions, "apenas no primeiro pedido")
+	}
+
+	if promotion.Expires != "" {
+		expires, _ := promotion.ExpiresAt()
+		conditions = append(conditions, fmt.Sprintf("até %s", expires.AddDate(0, 0, -1).Format("02/01/2006")))
+	}
+
+	if len(conditions) == 0 {
+		return fmt.Sprintf("%s: %s", promotion.Name, rule)
+	}
+
+	return fmt.Sprintf("%s: %s, %s", promotion.Name, rule, strings.Join(conditions, ", "))
+}
+
+func describeAutomaticPromotions(now time.Time) string {
+	descriptions := []string{}
+	for _, promotion := range Vault.Config.Promotions {
+		if promotion.Coupon == "" && !promotion.Expired(now) {
+			descriptions = append(descriptions, promotion.Describe())
+		}
+	}
+
+	if len(descriptions) == 0 {
+		return "nenhuma promoção ativa"
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+func hasCoupons() bool {
+	return slices.ContainsFunc(Vault.Config.Promotions, func(promotion Promotion) bool { return promotion.Coupon != "" })
+}
+
+func applyCouponTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "aplicar_cupom",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Valida e aplica um cupom de desconto informado pelo usuário. O desconto é calculado pelo sistema ao finalizar o pedido, nunca informe um valor de desconto que não tenha sido retornado por uma função."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"codigo",
+				},
+				"properties": map[string]interface{}{
+					"codigo": map[string]string{
+						"type":        "string",
+						"description": "Código do cupom informado pelo usuário",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func promotionsTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "consultar_promocoes",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Lista as promoções ativas aplicadas automaticamente. Deve ser chamado quando o usuário perguntar por promoções ou descontos, não ofereça nenhum desconto fora desta lista ou de um cupom válido."),
+			Parameters: openai.FunctionParameters{
+				"type":                 "object",
+				"required":             []string{},
+				"properties":           map[string]interface{}{},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) Promotions() string {
+	result := fmt.Sprintf("promoções ativas: %s", describeAutomaticPromotions(time.Now()))
+	if hasCoupons() {
+		result += ". Também existem cupons, aplique com aplicar_cupom apenas códigos informados pelo usuário"
+	}
+
+	return result
+}
+
+func (chat *WhatsAppChat) ApplyCoupon(request CouponRequest) string {
+	promotion, err := ValidateCoupon(request.Codigo, chat.Number, time.Now())
+	if err != nil {
+		chat.Coupon = ""
+		return fmt.Sprintf("cupom não aplicado: %s", err)
+	}
+
+	chat.Coupon = promotion.Coupon
+	return fmt.Sprintf("cupom %s aplicado (%s). O valor do desconto será calculado ao finalizar o pedido", promotion.Coupon, promotion.Describe())
+}
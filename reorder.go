@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const previousOrdersLimit = 5
+
+func previousOrdersTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "consultar_pedidos_anteriores",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Lista os últimos pedidos do usuário com data, produtos e valores. Deve ser chamado quando o usuário perguntar o que pediu antes."),
+			Parameters: openai.FunctionParameters{
+				"type":                 "object",
+				"required":             []string{},
+				"properties":           map[string]interface{}{},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func repeatLastOrderTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "repetir_ultimo_pedido",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Preenche o carrinho com os produtos do último pedido do usuário, com os preços atuais do catálogo. Deve ser chamado quando o usuário pedir \"o mesmo da última vez\". Informe ao usuário os produtos indisponíveis e confirme o carrinho antes de continuar."),
+			Parameters: openai.FunctionParameters{
+				"type":                 "object",
+				"required":             []string{},
+				"properties":           map[string]interface{}{},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) PreviousOrders() string {
+	orders := LoadOrders(chat.Number, previousOrdersLimit)
+	if len(orders) == 0 {
+		return "o usuário não possui pedidos anteriores"
+	}
+
+	lines := []string{}
+	for _, stored := range orders {
+		lines = append(lines, fmt.Sprintf(
+			"pedido #%d de %s, total %s: %s",
+			stored.ID,
+			stored.Created.Format("02/01/2006"),
+			stored.Order.ValorTotal,
+			describeProducts(stored.Order.Produtos),
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (chat *WhatsAppChat) RepeatLastOrder() string {
+	// cancelled and rejected orders are not repeated
+	orders := slices.DeleteFunc(LoadOrders(chat.Number, previousOrdersLimit), func(stored StoredOrder) bool {
+		return stored.Status == OrderCancelled || stored.Status == OrderRejected
+	})
+	if len(orders) == 0 {
+		return "o usuário não possui pedidos anteriores"
+	}
+
+	cart, unavailable := RepriceProducts(orders[0].Order.Produtos)
+	chat.Cart = cart
+
+	if len(cart) == 0 {
+		return fmt.Sprintf("nenhum produto do último pedido está disponível: %s", strings.Join(unavailable, ", "))
+	}
+
+	var subtotal Money
+	for _, product := range cart {
+		price, _ := ParseMoney(product.Valor)
+		subtotal += price * Money(product.Quantidade)
+	}
+
+	result := fmt.Sprintf("carrinho preenchido com os preços atuais: %s. Subtotal %s. Ao finalizar envie produtos vazio para usar este carrinho, ou a lista completa se o usuário mudar algo", describeProducts(cart), subtotal)
+	if len(unavailable) > 0 {
+		result = fmt.Sprintf("%s. Produtos que não estão mais disponíveis: %s", result, strings.Join(unavailable, ", "))
+	}
+
+	return result
+}
+
+// current catalog prices, discontinued and sold out products are left out and returned by name
+func RepriceProducts(products []Produto) ([]Produto, []string) {
+	cart := []Produto{}
+	unavailable := []string{}
+	levels := LoadStock()
+
+	for _, product := range products {
+		if len(Vault.Products.Products) == 0 {
+			cart = append(cart, product)
+			continue
+		}
+
+		catalogProduct, found := Vault.Products.Find(product.IdProduto)
+		if !found || catalogProduct.Descontinuado {
+			unavailable = append(unavailable, product.NomeProduto)
+			continue
+		}
+
+		if level := findStock(levels, catalogProduct.ID, productVariant(product)); level != nil && level.Quantity < product.Quantidade {
+			unavailable = append(unavailable, fmt.Sprintf("%s (esgotado)", product.NomeProduto))
+			continue
+		}
+
+		product.Valor = catalogProduct.Preco.String()
+		cart = append(cart, product)
+	}
+
+	return cart, unavailable
+}
+
+func describeProducts(products []Produto) string {
+	items := []string{}
+	for _, product := range products {
+		item := fmt.Sprintf("%dx %s", product.Quantidade, product.NomeProduto)
+		if product.Detalhes != "" {
+			item = fmt.Sprintf("%s (%s)", item, product.Detalhes)
+		}
+		items = append(items, fmt.Sprintf("%s %s", item, product.Valor))
+	}
+
+	return strings.Join(items, "; ")
+}
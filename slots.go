@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+const slotLayout = "2006-01-02 15:04"
+
+// slots split the business hours, or hours when there are no business hours, in windows of duration_minutes
+type DeliverySlotsConfig struct {
+	DurationMinutes int      `json:"duration_minutes"`
+	Capacity        int      `json:"capacity"`
+	LeadTimeMinutes int      `json:"lead_time_minutes"`
+	DaysAhead       int      `json:"days_ahead"`
+	ReminderMinutes int      `json:"reminder_minutes"`
+	Required        bool     `json:"required"`
+	Hours           []string `json:"hours"`
+	CalendarToken   string   `json:"calendar_token"`
+}
+
+type DeliverySlot struct {
+	Start     time.Time
+	End       time.Time
+	Available int
+}
+
+type DeliverySlotRequest struct {
+	Horario string `json:"horario"`
+}
+
+func (config DeliverySlotsConfig) Enabled() bool {
+	return config.Capacity > 0
+}
+
+func (config DeliverySlotsConfig) Validate() error {
+	if !config.Enabled() {
+		return nil
+	}
+
+	if config.DurationMinutes <= 0 {
+		return fmt.Errorf("duration_minutes must be greater than zero")
+	}
+
+	for _, interval := range config.Hours {
+		if _, err := parseInterval(interval); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (config DeliverySlotsConfig) intervals(day time.Time) []openInterval {
+	if Vault.Config.BusinessHours.Enabled() {
+		return Vault.Config.BusinessHours.intervals(day)
+	}
+
+	intervals := []openInterval{}
+	for _, text := range config.Hours {
+		interval, _ := parseInterval(text)
+		intervals = append(intervals, interval)
+	}
+
+	return intervals
+}
+
+// slots from now + lead time until days_ahead, with the remaining capacity
+func (config DeliverySlotsConfig) Slots(now time.Time) []DeliverySlot {
+	duration := time.Duration(config.DurationMinutes) * time.Minute
+	earliest := now.Add(time.Duration(config.LeadTimeMinutes) * time.Minute)
+	reserved := reservedSlots(earliest)
+
+	slots := []DeliverySlot{}
+	for offset := 0; offset <= config.DaysAhead; offset++ {
+		day := midnight(now).AddDate(0, 0, offset)
+		for _, interval := range config.intervals(day) {
+			for start := day.Add(interval.start); !start.Add(duration).After(day.Add(interval.end)); start = start.Add(duration) {
+				if start.Before(earliest) {
+					continue
+				}
+
+				slots = append(slots, DeliverySlot{
+					Start:     start,
+					End:       start.Add(duration),
+					Available: config.Capacity - reserved[start.Unix()],
+				})
+			}
+		}
+	}
+
+	return slots
+}
+
+// active orders per slot start
+func reservedSlots(from time.Time) map[int64]int {
+	rows, err := Vault.PGX.Query(
+		context.Background(),
+		"SELECT delivery_slot, count(*) FROM orders WHERE delivery_slot >= $1 AND status NOT IN ($2, $3) GROUP BY delivery_slot",
+		from,
+		OrderCancelled,
+		OrderRejected,
+	)
+	failOnError(err, "Can't load reserved slots")
+	defer rows.Close()
+
+	reserved := map[int64]int{}
+	for rows.Next() {
+		var slot time.Time
+		var count int
+		err = rows.Scan(&slot, &count)
+		failOnError(err, "Can't scan reserved slot")
+		reserved[slot.Unix()] = count
+	}
+	failOnError(rows.Err(), "Can't read reserved slots")
+
+	return reserved
+}
+
+func (slot DeliverySlot) String() string {
+	return fmt.Sprintf("%s, %s das %s às %s", weekdayNames[slot.Start.Weekday()], slot.Start.Format("02/01"), slot.Start.Format("15:04"), slot.End.Format("15:04"))
+}
+
+func findSlot(slots []DeliverySlot, start time.Time) (DeliverySlot, bool) {
+	index := slices.IndexFunc(slots, func(slot DeliverySlot) bool { return slot.Start.Equal(start) })
+	if index < 0 {
+		return DeliverySlot{}, false
+	}
+
+	return slots[index], true
+}
+
+// the cancelled order no longer holds its slot
+func ReleaseDeliverySlot(orderID int) {
+	_, err := Vault.PGX.Exec(context.Background(), "UPDATE orders SET delivery_slot = NULL WHERE id = $1", orderID)
+	failOnError(err, "Can't release delivery slot")
+}
+
+func scheduleDeliveryTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "agendar_entrega",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Lista os horários de entrega disponíveis quando chamado com horario vazio, ou reserva o horário escolhido pelo usuário. Ofereça apenas os horários retornados."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"horario",
+				},
+				"properties": map[string]interface{}{
+					"horario": map[string]string{
+						"type":        "string",
+						"description": "Início do horário escolhido no formato AAAA-MM-DD HH:MM, como retornado na lista, ou vazio para listar os horários",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) ScheduleDelivery(request DeliverySlotRequest) string {
+	config := Vault.Config.DeliverySlots
+	slots := config.Slots(time.Now())
+
+	if strings.TrimSpace(request.Horario) == "" {
+		lines := []string{}
+		for _, slot := range slots {
+			if slot.Available > 0 {
+				lines = append(lines, fmt.Sprintf("%s: %s", slot.Start.Format(slotLayout), slot))
+			}
+		}
+
+		if len(lines) == 0 {
+			return "nenhum horário de entrega disponível nos próximos dias"
+		}
+
+		return "horários disponíveis:\n" + strings.Join(lines, "\n")
+	}
+
+	start, err := time.ParseInLocation(slotLayout, strings.TrimSpace(request.Horario), time.Local)
+	if err != nil {
+		return fmt.Sprintf("horário %s inválido, use o formato AAAA-MM-DD HH:MM da lista", request.Horario)
+	}
+
+	slot, found := findSlot(slots, start)
+	if !found || slot.Available <= 0 {
+		chat.DeliverySlot = nil
+		return fmt.Sprintf("horário %s não está disponível, chame agendar_entrega com horario vazio para ver as opções", request.Horario)
+	}
+
+	chat.DeliverySlot = &slot.Start
+	return fmt.Sprintf("entrega agendada para %s, o horário fica reservado ao finalizar o pedido", slot)
+}
+
+func checkDeliverySlotRule(checkout *Checkout) []string {
+	config := Vault.Config.DeliverySlots
+	if !config.Enabled() {
+		return nil
+	}
+
+	if checkout.Chat.DeliverySlot == nil {
+		if config.Required {
+			return []string{"chame agendar_entrega e combine o horário de entrega com o usuário"}
+		}
+
+		return nil
+	}
+
+	slot, found := findSlot(config.Slots(time.Now()), *checkout.Chat.DeliverySlot)
+	if !found || slot.Available <= 0 {
+		checkout.Chat.DeliverySlot = nil
+		return []string{"o horário de entrega escolhido não está mais disponível, chame agendar_entrega para escolher outro"}
+	}
+
+	return nil
+}
+
+// reminds the staff of scheduled deliveries reminder_minutes before the slot
+func SendDeliveryReminders() {
+	config := Vault.Config.DeliverySlots
+	if !config.Enabled() || config.ReminderMinutes <= 0 {
+		return
+	}
+
+	now := time.Now()
+	rows, err := Vault.PGX.Query(
+		context.Background(),
+		`SELECT id FROM orders WHERE delivery_slot > $1 AND delivery_slot <= $2
+		AND NOT slot_reminded AND status NOT IN ($3, $4, $5)`,
+		now,
+		now.Add(time.Duration(config.ReminderMinutes)*time.Minute),
+		OrderCancelled,
+		OrderRejected,
+		OrderDelivered,
+	)
+	failOnError(err, "Can't load scheduled deliveries")
+
+	orderIDs := []int{}
+	for rows.Next() {
+		var orderID int
+		err = rows.Scan(&orderID)
+		failOnError(err, "Can't scan scheduled delivery")
+		orderIDs = append(orderIDs, orderID)
+	}
+	rows.Close()
+	failOnError(rows.Err(), "Can't read scheduled deliveries")
+
+	for _, orderID := range orderIDs {
+		stored := LoadOrderByID(orderID)
+		_, err := Vault.PGX.Exec(context.Background(), "UPDATE orders SET slot_reminded = true WHERE id = $1", orderID)
+		failOnError(err, "Can't mark delivery reminder")
+
+		NotifyStaff(Notification{
+			Event:    EventDeliveryReminder,
+			Message:  RenderMessage("lembrete_entrega", MessageData{OrderID: orderID, Customer: stored.Order.NomeCompleto, Order: stored.Order}),
+			OrderID:  orderID,
+			Customer: stored.Order.NomeCompleto,
+		})
+	}
+}
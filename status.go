@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+const (
+	OrderReceived   = "recebido"
+	OrderPreparing  = "em_preparo"
+	OrderDispatched = "saiu_para_entrega"
+	OrderDelivered  = "entregue"
+	OrderCancelled  = "cancelado"
+
+	OrderCancelRequested  = "cancelamento_solicitado"
+	OrderAwaitingApproval = "aguardando_aprovacao"
+	OrderRejected         = "rejeitado"
+	OrderPaid             = "pago"
+)
+
+var orderStatusLabels = map[string]string{
+	OrderReceived:   "Recebido",
+	OrderPreparing:  "Em preparo",
+	OrderDispatched: "Saiu para entrega",
+	OrderDelivered:  "Entregue",
+	OrderCancelled:  "Cancelado",
+
+	OrderCancelRequested:  "Cancelamento solicitado",
+	OrderAwaitingApproval: "Aguardando aprovação da loja",
+	OrderRejected:         "Recusado pela loja",
+	OrderPaid:             "Pagamento confirmado",
+}
+
+// statuses the owner can set, in lifecycle order
+var orderStatuses = []string{
+	OrderReceived,
+	OrderPreparing,
+	OrderDispatched,
+	OrderDelivered,
+	OrderCancelled,
+}
+
+// statuses the owner can move an order to with /status, cancelled orders go through CancelOrder and
+// orders awaiting approval through ApproveOrder, so stock, slots and charges follow the order
+var orderTransitions = map[string][]string{
+	OrderReceived:   {OrderPreparing, OrderDispatched, OrderDelivered},
+	OrderPaid:       {OrderPreparing, OrderDispatched, OrderDelivered},
+	OrderPreparing:  {OrderReceived, OrderDispatched, OrderDelivered},
+	OrderDispatched: {OrderDelivered},
+}
+
+// statuses in which the customer can still change or cancel the order
+var orderEditableStatuses = []string{
+	OrderAwaitingApproval,
+	OrderReceived,
+}
+
+type OrderStatusRequest struct {
+	NumeroPedido int `json:"numero_pedido"`
+}
+
+func OrderStatusLabel(status string) string {
+	if label, found := orderStatusLabels[status]; found {
+		return label
+	}
+
+	return status
+}
+
+func UpdateOrderStatus(orderID int, status string) (string, error) {
+	if !slices.Contains(orderStatuses, status) {
+		return "", fmt.Errorf("status %s inválido, use: %s", status, strings.Join(orderStatuses, ", "))
+	}
+
+	if status == OrderCancelled {
+		return CancelOrder(orderID)
+	}
+
+	stored := LoadOrderByID(orderID)
+	if stored == nil {
+		return "", fmt.Errorf("pedido #%d não encontrado", orderID)
+	}
+
+	if stored.Status == OrderAwaitingApproval {
+		return "", fmt.Errorf("pedido #%d aguarda aprovação, use /aprovar %d ou /rejeitar %d <motivo>", orderID, orderID, orderID)
+	}
+
+	if !slices.Contains(orderTransitions[stored.Status], status) {
+		return "", fmt.Errorf("pedido #%d está %s e não pode passar para %s", orderID, strings.ToLower(OrderStatusLabel(stored.Status)), strings.ToLower(OrderStatusLabel(status)))
+	}
+
+	return TransitionOrderStatus(orderID, stored.Status, status)
+}
+
+func SetOrderStatus(orderID int, status string) (string, error) {
+	var phoneNumber string
+	err := Vault.PGX.QueryRow(
+		context.Background(),
+		"UPDATE orders SET status = $2, updated = now() WHERE id = $1 RETURNING phone_number",
+		orderID,
+		status,
+	).Scan(&phoneNumber)
+	if err != nil {
+		return "", fmt.Errorf("pedido #%d não encontrado", orderID)
+	}
+
+	return phoneNumber, nil
+}
+
+// changes the status only when the order is still in the expected one
+func TransitionOrderStatus(orderID int, from string, to string) (string, error) {
+	var phoneNumber string
+	err := Vault.PGX.QueryRow(
+		context.Background(),
+		"UPDATE orders SET status = $3, updated = now() WHERE id = $1 AND status = $2 RETURNING phone_number",
+		orderID,
+		from,
+		to,
+	).Scan(&phoneNumber)
+	if err != nil {
+		return "", fmt.Errorf("pedido #%d não encontrado como %s", orderID, OrderStatusLabel(from))
+	}
+
+	return phoneNumber, nil
+}
+
+func orderStatusTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "consultar_status_pedido",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Consulta a situação dos pedidos recentes do usuário, por exemplo quando ele perguntar se o pedido já saiu para entrega. Responda somente com as informações retornadas."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"numero_pedido",
+				},
+				"properties": map[string]interface{}{
+					"numero_pedido": map[string]string{
+						"type":        "integer",
+						"description": "Número do pedido informado pelo usuário, ou 0 para os pedidos mais recentes",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+// only orders of the chat phone number are visible
+func (chat *WhatsAppChat) OrderStatus(request OrderStatusRequest) string {
+	orders := []StoredOrder{}
+	if request.NumeroPedido > 0 {
+		if stored := LoadOrder(chat.Number, request.NumeroPedido); stored != nil {
+			orders = append(orders, *stored)
+		}
+	} else {
+		orders = LoadOrders(chat.Number, previousOrdersLimit)
+	}
+
+	if len(orders) == 0 {
+		if request.NumeroPedido > 0 {
+			return fmt.Sprintf("pedido #%d não encontrado entre os pedidos deste usuário", request.NumeroPedido)
+		}
+		return "o usuário não possui pedidos"
+	}
+
+	lines := []string{}
+	for _, stored := range orders {
+		line := fmt.Sprintf(
+			"pedido #%d feito em %s, total %s, situação: %s (atualizado em %s)",
+			stored.ID,
+			stored.Created.Format("02/01/2006 15:04"),
+			stored.Order.ValorTotal,
+			OrderStatusLabel(stored.Status),
+			stored.Updated.Format("02/01/2006 15:04"),
+		)
+		if stored.Paid {
+			line += ", pagamento online confirmado"
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
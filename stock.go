@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/openai/openai-go"
+)
+
+const maxStockAlternatives = 3
+
+// products without a stock row are not tracked and never run out
+type StockLevel struct {
+	ProductID string
+	Variant   string
+	Quantity  int
+}
+
+type StockRequest struct {
+	IdProduto string `json:"id_produto"`
+}
+
+func LoadStock() []StockLevel {
+	rows, err := Vault.PGX.Query(context.Background(), "SELECT product_id, variant, quantity FROM stock ORDER BY product_id, variant")
+	failOnError(err, "Can't load stock")
+	defer rows.Close()
+
+	levels := []StockLevel{}
+	for rows.Next() {
+		var level StockLevel
+		err = rows.Scan(&level.ProductID, &level.Variant, &level.Quantity)
+		failOnError(err, "Can't scan stock")
+		levels = append(levels, level)
+	}
+	failOnError(rows.Err(), "Can't read stock")
+
+	return levels
+}
+
+func SetStock(productID string, variant string, quantity int) {
+	_, err := Vault.PGX.Exec(
+		context.Background(),
+		`INSERT INTO stock (product_id, variant, quantity, updated) VALUES ($1, $2, $3, now())
+		ON CONFLICT (product_id, variant) DO UPDATE SET quantity = EXCLUDED.quantity, updated = now()`,
+		productID,
+		variant,
+		quantity,
+	)
+	failOnError(err, "Can't set stock")
+}
+
+// the catalog variant mentioned in the product details, ex. "sabor chocolate" for the variant "Chocolate"
+func productVariant(product Produto) string {
+	catalogProduct, found := Vault.Products.Find(product.IdProduto)
+	if !found {
+		return ""
+	}
+
+	return matchVariant(product.Detalhes, catalogProduct.Variantes)
+}
+
+// the longest variant found as whole words, so "chocolate branco" is not taken as "Chocolate"
+func matchVariant(details string, variants []string) string {
+	words := func(text string) string {
+		return " " + strings.Join(strings.FieldsFunc(normalizeText(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}), " ") + " "
+	}
+
+	text := words(details)
+	match := ""
+	for _, variant := range variants {
+		name := words(variant)
+		if strings.TrimSpace(name) != "" && strings.Contains(text, name) && len(name) > len(words(match)) {
+			match = variant
+		}
+	}
+
+	return match
+}
+
+// variant stock first, then the stock of the whole product
+func findStock(levels []StockLevel, productID string, variant string) *StockLevel {
+	for _, candidate := range []string{variant, ""} {
+		index := slices.IndexFunc(levels, func(level StockLevel) bool {
+			return level.ProductID == productID && strings.EqualFold(level.Variant, candidate)
+		})
+		if index >= 0 {
+			return &levels[index]
+		}
+	}
+
+	return nil
+}
+
+// quantity of each tracked stock row the products use
+func stockUsage(levels []StockLevel, products []Produto) map[*StockLevel]int {
+	usage := map[*StockLevel]int{}
+	for _, product := range products {
+		if level := findStock(levels, product.IdProduto, productVariant(product)); level != nil {
+			usage[level] += product.Quantidade
+		}
+	}
+
+	return usage
+}
+
+func describeStockItem(productID string, variant string) string {
+	name := productID
+	if catalogProduct, found := Vault.Products.Find(productID); found {
+		name = catalogProduct.Nome
+	}
+
+	if variant != "" {
+		return fmt.Sprintf("%s (%s)", name, variant)
+	}
+
+	return name
+}
+
+// products with stock per variant need the variant in the details, otherwise nothing would be decremented
+func hasVariantStock(levels []StockLevel, productID string) bool {
+	return findStock(levels, productID, "") == nil && slices.ContainsFunc(levels, func(level StockLevel) bool {
+		return level.ProductID == productID && level.Variant != ""
+	})
+}
+
+// available variants of the product, sold out ones left out
+func availableVariants(levels []StockLevel, catalogProduct CatalogProduct) []string {
+	variants := []string{}
+	for _, variant := range catalogProduct.Variantes {
+		if level := findStock(levels, catalogProduct.ID, variant); level == nil || level.Quantity > 0 {
+			variants = append(variants, variant)
+		}
+	}
+
+	return variants
+}
+
+func CheckStock(products []Produto) []string {
+	levels := LoadStock()
+	violations := []string{}
+	for _, product := range products {
+		if productVariant(product) != "" || !hasVariantStock(levels, product.IdProduto) {
+			continue
+		}
+
+		// products out of the catalog are reported by the products rule
+		catalogProduct, found := Vault.Products.Find(product.IdProduto)
+		if !found {
+			continue
+		}
+
+		violations = append(violations, fmt.Sprintf("informe nos detalhes de %s a variação escolhida pelo usuário, disponíveis: %s", catalogProduct.Nome, strings.Join(availableVariants(levels, *catalogProduct), ", ")))
+	}
+
+	for level, quantity := range stockUsage(levels, products) {
+		if quantity <= level.Quantity {
+			continue
+		}
+
+		violation := fmt.Sprintf("%s esgotado", describeStockItem(level.ProductID, level.Variant))
+		if level.Quantity > 0 {
+			violation = fmt.Sprintf("%s tem apenas %d em estoque", describeStockItem(level.ProductID, level.Variant), level.Quantity)
+		}
+
+		if alternatives := stockAlternatives(levels, level.ProductID, level.Variant); len(alternatives) > 0 {
+			violation = fmt.Sprintf("%s, sugira: %s", violation, strings.Join(alternatives, ", "))
+		}
+
+		violations = append(violations, violation)
+	}
+
+	slices.Sort(violations)
+	return violations
+}
+
+// other variants of the product, then products of the same category
+func stockAlternatives(levels []StockLevel, productID string, variant string) []string {
+	catalogProduct, found := Vault.Products.Find(productID)
+	if !found {
+		return nil
+	}
+
+	alternatives := []string{}
+	available := func(id string, variant string) bool {
+		level := findStock(levels, id, variant)
+		return level == nil || level.Quantity > 0
+	}
+
+	for _, other := range catalogProduct.Variantes {
+		if !strings.EqualFold(other, variant) && available(productID, other) {
+			alternatives = append(alternatives, describeStockItem(productID, other))
+		}
+	}
+
+	for _, other := range Vault.Products.Products {
+		if other.ID == productID || other.Descontinuado || other.Categoria == "" || !strings.EqualFold(other.Categoria, catalogProduct.Categoria) {
+			continue
+		}
+
+		if available(other.ID, "") {
+			alternatives = append(alternatives, other.Nome)
+		}
+	}
+
+	return alternatives[:min(len(alternatives), maxStockAlternatives)]
+}
+
+func DecrementStock(products []Produto) {
+	changeStock(products, -1)
+}
+
+func RestoreStock(products []Produto) {
+	changeStock(products, 1)
+}
+
+func changeStock(products []Produto, sign int) {
+	for level, quantity := range stockUsage(LoadStock(), products) {
+		_, err := Vault.PGX.Exec(
+			context.Background(),
+			"UPDATE stock SET quantity = greatest(quantity + $3, 0), updated = now() WHERE product_id = $1 AND variant = $2",
+			level.ProductID,
+			level.Variant,
+			sign*quantity,
+		)
+		failOnError(err, "Can't update stock")
+	}
+}
+
+// told to the model every turn so sold out items are not offered
+func OutOfStockNote() string {
+	items := []string{}
+	for _, level := range LoadStock() {
+		if level.Quantity <= 0 {
+			items = append(items, describeStockItem(level.ProductID, level.Variant))
+		}
+	}
+
+	if len(items) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("Produtos esgotados no momento, não ofereça: %s", strings.Join(items, ", "))
+}
+
+func checkStockTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "verificar_estoque",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Consulta o estoque de um produto e das suas variações, por exemplo quando o usuário perguntar se um sabor está disponível."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"id_produto",
+				},
+				"properties": map[string]interface{}{
+					"id_produto": map[string]string{
+						"type":        "string",
+						"description": "Identificador único do produto, ou o nome do produto quando o identificador não for conhecido",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func (chat *WhatsAppChat) CheckStock(request StockRequest) string {
+	catalogProduct, found := Vault.Products.Find(request.IdProduto)
+	if !found {
+		return fmt.Sprintf("produto %s não encontrado no catálogo", request.IdProduto)
+	}
+
+	if catalogProduct.Descontinuado {
+		return fmt.Sprintf("%s não está mais disponível", catalogProduct.Nome)
+	}
+
+	levels := LoadStock()
+	describe := func(variant string) string {
+		level := findStock(levels, catalogProduct.ID, variant)
+		switch {
+		case level == nil:
+			return "disponível"
+		case level.Quantity <= 0:
+			return "esgotado"
+		default:
+			return fmt.Sprintf("%d disponíveis", level.Quantity)
+		}
+	}
+
+	if len(catalogProduct.Variantes) == 0 {
+		return fmt.Sprintf("%s: %s", catalogProduct.Nome, describe(""))
+	}
+
+	lines := []string{catalogProduct.Nome}
+	for _, variant := range catalogProduct.Variantes {
+		lines = append(lines, fmt.Sprintf("%s: %s", variant, describe(variant)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// /estoque lists the tracked stock, /estoque <produto> [variante] <quantidade> sets it
+func ownerStock(args []string) string {
+	if len(args) == 0 {
+		lines := []string{"Estoque:"}
+		for _, level := range LoadStock() {
+			lines = append(lines, fmt.Sprintf("%s: %d", describeStockItem(level.ProductID, level.Variant), level.Quantity))
+		}
+
+		if len(lines) == 1 {
+			return "Nenhum produto com controle de estoque"
+		}
+
+		return strings.Join(lines, "\n")
+	}
+
+	if len(args) < 2 {
+		return ownerHelp()
+	}
+
+	quantity, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || quantity < 0 {
+		return fmt.Sprintf("quantidade inválida: %s", args[len(args)-1])
+	}
+
+	catalogProduct, found := Vault.Products.Find(args[0])
+	if !found {
+		return fmt.Sprintf("produto %s não encontrado no catálogo", args[0])
+	}
+
+	variant := strings.Join(args[1:len(args)-1], " ")
+	if variant != "" {
+		index := slices.IndexFunc(catalogProduct.Variantes, func(name string) bool { return normalizeText(name) == normalizeText(variant) })
+		if index < 0 {
+			return fmt.Sprintf("variação %s não encontrada, opções: %s", variant, strings.Join(catalogProduct.Variantes, ", "))
+		}
+		variant = catalogProduct.Variantes[index]
+	}
+
+	SetStock(catalogProduct.ID, variant, quantity)
+	return fmt.Sprintf("Estoque de %s atualizado para %d", describeStockItem(catalogProduct.ID, variant), quantity)
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestMatchVariant(t *testing.T) {
+	variants := []string{"Chocolate", "Chocolate Branco", "Morango"}
+	tests := []struct {
+		details string
+		want    string
+	}{
+		{"sabor chocolate", "Chocolate"},
+		{"sabor chocolate branco", "Chocolate Branco"},
+		{"Chocolate-Branco, sem açúcar", "Chocolate Branco"},
+		{"morangos", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.details, func(t *testing.T) {
+			if got := matchVariant(test.details, variants); got != test.want {
+				t.Errorf("matchVariant(%q) = %q, want %q", test.details, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/openai/openai-go"
+)
+
+const maxToolRounds = 5
+
+func (chat *WhatsAppChat) Tools() []openai.ChatCompletionToolParam {
+	tools := []openai.ChatCompletionToolParam{
+		finishCheckoutTool(),
+		choosePaymentTool(),
+		sendOptionsTool(),
+		sendProductPhotoTool(),
+		checkStockTool(),
+		validateAddressTool(),
+		confirmAddressTool(),
+		handoffTool(),
+	}
+
+	if chat.Customer != nil && len(chat.Customer.Addresses) > 0 {
+		tools = append(tools, pickSavedAddressTool())
+	}
+
+	if chat.Customer != nil && chat.Customer.OrderCount > 0 {
+		tools = append(tools, previousOrdersTool(), repeatLastOrderTool(), orderStatusTool(), amendOrderTool(), cancelOrderTool())
+	}
+
+	if len(Vault.Products.Products) > 0 {
+		tools = append(tools, listCatalogTool())
+	}
+
+	if len(Vault.Config.Promotions) > 0 {
+		tools = append(tools, promotionsTool())
+	}
+
+	if hasCoupons() {
+		tools = append(tools, applyCouponTool())
+	}
+
+	if Vault.Config.DeliverySlots.Enabled() {
+		tools = append(tools, scheduleDeliveryTool())
+	}
+
+	if Vault.Config.Delivery.Enabled() {
+		tools = append(tools, calculateDeliveryTool())
+	}
+
+	// the enum of documents can't be empty
+	if len(Vault.Documents.Names()) > 0 {
+		tools = append(tools, sendDocumentTool())
+	}
+
+	return tools
+}
+
+// picks the tool call of the last completion, if any
+func (chat *WhatsAppChat) NextToolCall() bool {
+	if len(chat.OpenAIStack.Choices) == 0 {
+		return false
+	}
+
+	lastMessage := chat.OpenAIStack.Choices[len(chat.OpenAIStack.Choices)-1]
+	if len(lastMessage.Message.ToolCalls) == 0 {
+		return false
+	}
+
+	return chat.HasToolCallInLastMessage(lastMessage.Message.ToolCalls[0].Function.Name, true)
+}
+
+// runs the current tool call, returns the tool response and if the conversation is over
+func (chat *WhatsAppChat) HandleToolCall() (string, bool) {
+	switch name := chat.ToolCall.Function.Name; name {
+	case "enviar_documento":
+		var request DocumentRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.SendDocument(request), false
+
+	case "enviar_opcoes":
+		var choice InteractiveChoice
+		if err := GetToolArgs(chat.ToolCall, &choice); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.SendOptions(choice), false
+
+	case "enviar_foto_produto":
+		var request ProductPhotoRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.SendProductPhotos(request), false
+
+	case "calcular_frete":
+		var request DeliveryRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.CalculateDelivery(request), false
+
+	case "validar_endereco":
+		var request AddressRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.ValidateAddress(request), false
+
+	case "confirmar_endereco":
+		return chat.ConfirmAddress(), false
+
+	case "usar_endereco_salvo":
+		var request SavedAddressRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.PickSavedAddress(request), false
+
+	case "consultar_pedidos_anteriores":
+		return chat.PreviousOrders(), false
+
+	case "repetir_ultimo_pedido":
+		return chat.RepeatLastOrder(), false
+
+	case "consultar_status_pedido":
+		var request OrderStatusRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.OrderStatus(request), false
+
+	case "alterar_pedido":
+		var request AmendOrderRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.AmendOrder(request), false
+
+	case "cancelar_pedido":
+		var request CancelOrderRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.CancelOrder(request), false
+
+	case "consultar_catalogo":
+		var request CatalogRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.ListCatalog(request), false
+
+	case "verificar_estoque":
+		var request StockRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.CheckStock(request), false
+
+	case "agendar_entrega":
+		var request DeliverySlotRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.ScheduleDelivery(request), false
+
+	case "consultar_promocoes":
+		return chat.Promotions(), false
+
+	case "aplicar_cupom":
+		var request CouponRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.ApplyCoupon(request), false
+
+	case "chamar_atendente":
+		var request HandoffRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.RequestHandoff(request), false
+
+	case "escolher_forma_de_pagamento":
+		var request PaymentChoiceRequest
+		if err := GetToolArgs(chat.ToolCall, &request); err != nil {
+			return fmt.Sprintf("argumentos inválidos: %s", err), false
+		}
+
+		return chat.ChoosePaymentMethod(request), false
+
+	case "finalizar_checkout":
+		return chat.FinishCheckout()
+
+	default:
+		return fmt.Sprintf("função %s desconhecida", name), false
+	}
+}
+
+func finishCheckoutTool() openai.ChatCompletionToolParam {
+	return openai.ChatCompletionToolParam{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "finalizar_checkout",
+			Strict:      openai.Bool(true),
+			Description: openai.String("Deve ser chamado após finalizar a escolha dos produtos e uma forma de pagamento. Ou seja, assim que você retonar a mensagem \"Pedido confirmado\". Quando a forma de pagamento exigir comprovante o usuário precisa ter enviado o comprovante, mas não é necessário validar o conteúdo. Descontos são calculados pelo sistema e informados no retorno"),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"required": []string{
+					"produtos",
+					"valor_total",
+					"nome_completo",
+					"endereco",
+					"forma_de_pagamento",
+					"troco_para",
+				},
+				"properties": map[string]interface{}{
+					"produtos": productsSchema("Lista de produtos no carrinho, vazia para usar o carrinho preenchido por repetir_ultimo_pedido"),
+					"valor_total": map[string]string{
+						"type":        "string",
+						"description": "Valor total da compra, somando todos os produtos",
+					},
+					"nome_completo": map[string]string{
+						"type":        "string",
+						"description": "Nome completo do usuário",
+					},
+					"endereco": map[string]string{
+						"type":        "string",
+						"description": "Endereço de entrega dos produtos",
+					},
+					"forma_de_pagamento": map[string]interface{}{
+						"type":        "string",
+						"description": fmt.Sprintf("A forma de pagamento escolhida pelo usuário. Opções: %s", describePaymentMethods()),
+						"enum":        PaymentMethodIDs(),
+					},
+					"troco_para": map[string]string{
+						"type":        "string",
+						"description": "Valor que o usuário vai entregar para pagar, usado para calcular o troco. Pergunte apenas quando a forma de pagamento pedir troco, caso contrário envie vazio",
+					},
+				},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func productsSchema(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "array",
+		"description": description,
+		"items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"id_produto": map[string]string{
+					"type":        "string",
+					"description": "Identificador único do produto",
+				},
+				"nome_produto": map[string]string{
+					"type":        "string",
+					"description": "Nome do produto",
+				},
+				"quantidade": map[string]string{
+					"type":        "number",
+					"description": "Quantidade do produto",
+				},
+				"valor": map[string]string{
+					"type":        "string",
+					"description": "Preço unitário do produto",
+				},
+				"detalhes": map[string]string{
+					"type":        "string",
+					"description": "Sabor e qualquer outro detalhe acrescentado durante a conversa",
+				},
+			},
+			"additionalProperties": false,
+			"required": []string{
+				"id_produto",
+				"nome_produto",
+				"quantidade",
+				"valor",
+				"detalhes",
+			},
+		},
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type EvolutionUpsert struct {
+	Event    string              `json:"event"`
+	Instance string              `json:"instance"`
+	Data     EvolutionUpsertData `json:"data"`
+}
+
+type EvolutionUpsertData struct {
+	Key         EvolutionMessageKey     `json:"key"`
+	PushName    string                  `json:"pushName"`
+	Message     EvolutionMessageContent `json:"message"`
+	MessageType string                  `json:"messageType"`
+}
+
+type EvolutionMessageKey struct {
+	RemoteJID string `json:"remoteJid"`
+	FromMe    bool   `json:"fromMe"`
+	ID        string `json:"id"`
+}
+
+type EvolutionContextInfo struct {
+	StanzaID      string                   `json:"stanzaId"`
+	Participant   string                   `json:"participant"`
+	QuotedMessage *EvolutionMessageContent `json:"quotedMessage"`
+}
+
+type EvolutionExtendedText struct {
+	Text        string                `json:"text"`
+	ContextInfo *EvolutionContextInfo `json:"contextInfo"`
+}
+
+type EvolutionMediaMessage struct {
+	Caption     string                `json:"caption"`
+	Mimetype    string                `json:"mimetype"`
+	FileName    string                `json:"fileName"`
+	ContextInfo *EvolutionContextInfo `json:"contextInfo"`
+}
+
+type EvolutionLocation struct {
+	DegreesLatitude  float64 `json:"degreesLatitude"`
+	DegreesLongitude float64 `json:"degreesLongitude"`
+	Name             string  `json:"name"`
+	Address          string  `json:"address"`
+}
+
+type EvolutionContact struct {
+	DisplayName string `json:"displayName"`
+	Vcard       string `json:"vcard"`
+}
+
+type EvolutionButtonsResponse struct {
+	SelectedButtonID    string `json:"selectedButtonId"`
+	SelectedDisplayText string `json:"selectedDisplayText"`
+}
+
+type EvolutionListResponse struct {
+	Title             string `json:"title"`
+	SingleSelectReply struct {
+		SelectedRowID string `json:"selectedRowId"`
+	} `json:"singleSelectReply"`
+}
+
+type EvolutionTemplateButtonReply struct {
+	SelectedID          string `json:"selectedId"`
+	SelectedDisplayText string `json:"selectedDisplayText"`
+}
+
+type EvolutionMessageContent struct {
+	Conversation        string                 `json:"conversation"`
+	ExtendedTextMessage *EvolutionExtendedText `json:"extendedTextMessage"`
+	ImageMessage        *EvolutionMediaMessage `json:"imageMessage"`
+	DocumentMessage     *EvolutionMediaMessage `json:"documentMessage"`
+	LocationMessage     *EvolutionLocation     `json:"locationMessage"`
+	ContactMessage      *EvolutionContact      `json:"contactMessage"`
+
+	ButtonsResponseMessage     *EvolutionButtonsResponse     `json:"buttonsResponseMessage"`
+	ListResponseMessage        *EvolutionListResponse        `json:"listResponseMessage"`
+	TemplateButtonReplyMessage *EvolutionTemplateButtonReply `json:"templateButtonReplyMessage"`
+}
+
+func (data EvolutionUpsertData) PhoneNumber() string {
+	reg := regexp.MustCompile(`^(\d+)@.+`)
+	match := reg.FindStringSubmatch(data.Key.RemoteJID)
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
+}
+
+func (content EvolutionMessageContent) Text() string {
+	switch {
+	case content.Conversation != "":
+		return content.Conversation
+	case content.ExtendedTextMessage != nil:
+		return content.ExtendedTextMessage.Text
+	case content.ImageMessage != nil:
+		return content.ImageMessage.Caption
+	case content.DocumentMessage != nil:
+		return content.DocumentMessage.Caption
+	case content.LocationMessage != nil:
+		return content.LocationMessage.Describe()
+	case content.ContactMessage != nil:
+		return content.ContactMessage.DisplayName
+	case content.ButtonsResponseMessage != nil:
+		return content.ButtonsResponseMessage.SelectedDisplayText
+	case content.ListResponseMessage != nil:
+		return content.ListResponseMessage.Title
+	case content.TemplateButtonReplyMessage != nil:
+		return content.TemplateButtonReplyMessage.SelectedDisplayText
+	}
+
+	return ""
+}
+
+// button replies carry the command in the option id
+func (content EvolutionMessageContent) CommandText() string {
+	if id := content.SelectedOptionID(); strings.HasPrefix(id, "/") {
+		return id
+	}
+
+	return content.Text()
+}
+
+func (content EvolutionMessageContent) SelectedOptionID() string {
+	switch {
+	case content.ButtonsResponseMessage != nil:
+		return content.ButtonsResponseMessage.SelectedButtonID
+	case content.ListResponseMessage != nil:
+		return content.ListResponseMessage.SingleSelectReply.SelectedRowID
+	case content.TemplateButtonReplyMessage != nil:
+		return content.TemplateButtonReplyMessage.SelectedID
+	}
+
+	return ""
+}
+
+func (content EvolutionMessageContent) ContextInfo() *EvolutionContextInfo {
+	switch {
+	case content.ExtendedTextMessage != nil:
+		return content.ExtendedTextMessage.ContextInfo
+	case content.ImageMessage != nil:
+		return content.ImageMessage.ContextInfo
+	case content.DocumentMessage != nil:
+		return content.DocumentMessage.ContextInfo
+	}
+
+	return nil
+}
+
+func (location EvolutionLocation) Describe() string {
+	parts := []string{}
+	if location.Name != "" {
+		parts = append(parts, location.Name)
+	}
+
+	if location.Address != "" {
+		parts = append(parts, location.Address)
+	}
+
+	coordinates := fmt.Sprintf("lat %.6f, long %.6f", location.DegreesLatitude, location.DegreesLongitude)
+	if len(parts) == 0 {
+		return coordinates
+	}
+
+	return fmt.Sprintf("%s (%s)", strings.Join(parts, " - "), coordinates)
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"sync"
+	"time"
+
 	"github.com/jackc/pgx/v5"
 )
 
@@ -16,7 +19,16 @@ type AppVault struct {
 	PGX                  *pgx.Conn
 	OwnerNumber          string
 	EnableForMe          bool
-	CatalogAttachment    []byte
+	TypingDelayPerChar   time.Duration
+	EnableInteractive    bool
+	Config               StoreConfig
+	Products             *ProductCatalog
+	Documents            *DocumentStore
+	Messages             *MessageTemplates
+	CEPLookup            CEPLookup
+	Payments             PaymentProvider
+	CalendarEmail        string
+	Lock                 sync.Mutex
 }
 
 var Vault AppVault
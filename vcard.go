@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+)
+
+type Contact struct {
+	Name   string   `json:"name"`
+	Phones []string `json:"phones"`
+	Emails []string `json:"emails"`
+}
+
+func ParseVCard(vcard string) Contact {
+	var contact Contact
+
+	// unfold continuation lines before reading properties
+	vcard = strings.ReplaceAll(vcard, "\r\n", "\n")
+	vcard = strings.ReplaceAll(vcard, "\n ", "")
+
+	for _, line := range strings.Split(vcard, "\n") {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		// strip params and group prefix, ex. item1.TEL;waid=5511999999999
+		name, _, _ = strings.Cut(name, ";")
+		if _, after, grouped := strings.Cut(name, "."); grouped {
+			name = after
+		}
+
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		switch strings.ToUpper(name) {
+		case "FN":
+			contact.Name = value
+		case "N":
+			if contact.Name == "" {
+				parts := strings.Split(value, ";")
+				if len(parts) > 1 {
+					contact.Name = strings.TrimSpace(parts[1] + " " + parts[0])
+				} else {
+					contact.Name = parts[0]
+				}
+			}
+		case "TEL":
+			contact.Phones = append(contact.Phones, value)
+		case "EMAIL":
+			contact.Emails = append(contact.Emails, value)
+		}
+	}
+
+	return contact
+}
+
+func (contact Contact) Describe() string {
+	description := contact.Name
+	if len(contact.Phones) > 0 {
+		description += ", telefone " + strings.Join(contact.Phones, " / ")
+	}
+
+	if len(contact.Emails) > 0 {
+		description += ", e-mail " + strings.Join(contact.Emails, " / ")
+	}
+
+	return description
+}